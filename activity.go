@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// group activity levels, by the average messages per day of the recent days
+const (
+	ActivityHigh     = "high"
+	ActivityMedium   = "medium"
+	ActivityLow      = "low"
+	ActivityInactive = "inactive"
+)
+
+const (
+	activityDayFormat = "20060102"
+	activityWindow    = 7                   // days taken into account for the activity level
+	activityRetention = 30 * 24 * time.Hour // daily activity rows expire after this
+)
+
+var (
+	// tracking is opt-in, it needs the bot's privacy mode disabled to see the group messages
+	activityTrackingEnabled bool
+	activityFlushInterval   = time.Minute
+
+	activity = newActivityTracker()
+)
+
+// groupActivity is the activity of a group within a day, no message content is kept
+type groupActivity struct {
+	messages int
+	users    map[int64]bool
+}
+
+type activityKey struct {
+	chatID int64
+	day    string
+}
+
+// activityTracker aggregates the activities in memory until flushed
+type activityTracker struct {
+	mu     sync.Mutex
+	groups map[activityKey]*groupActivity
+}
+
+func newActivityTracker() *activityTracker {
+	return &activityTracker{groups: map[activityKey]*groupActivity{}}
+}
+
+func (t *activityTracker) track(chatID, userID int64, at time.Time) {
+	key := activityKey{chatID: chatID, day: at.UTC().Format(activityDayFormat)}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a, ok := t.groups[key]
+	if !ok {
+		a = &groupActivity{users: map[int64]bool{}}
+		t.groups[key] = a
+	}
+	a.messages++
+	if userID != 0 {
+		a.users[userID] = true
+	}
+}
+
+// take hands over the aggregated activities and starts a new aggregation
+func (t *activityTracker) take() map[activityKey]*groupActivity {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	groups := t.groups
+	t.groups = map[activityKey]*groupActivity{}
+	return groups
+}
+
+func (t *activityTracker) flush(ctx context.Context) {
+	groups := t.take()
+	if len(groups) == 0 {
+		return
+	}
+
+	flushed := map[int64]bool{}
+	for key, a := range groups {
+		users := make([]int64, 0, len(a.users))
+		for u := range a.users {
+			users = append(users, u)
+		}
+		ddbAddActivity(ctx, ActivityRecord{
+			ChatID:   key.chatID,
+			Day:      key.day,
+			Messages: a.messages,
+			Users:    users,
+			ExpireAt: time.Now().Add(activityRetention).Unix(),
+		})
+		flushed[key.chatID] = true
+	}
+
+	// refresh the activity level of the groups we've got new activities
+	since := time.Now().UTC().AddDate(0, 0, -activityWindow+1).Format(activityDayFormat)
+	for chatID := range flushed {
+		messages, users := 0, 0
+		for _, r := range ddbGetActivity(ctx, chatID, since) {
+			messages += r.Messages
+			users += len(r.Users)
+		}
+		updateGroup(ctx, chatID, map[string]interface{}{
+			"activity":           getActivityLevel(messages / activityWindow),
+			"daily_messages":     messages / activityWindow,
+			"daily_active_users": users / activityWindow,
+		})
+	}
+}
+
+func getActivityLevel(dailyMessages int) string {
+	switch {
+	case dailyMessages >= 100:
+		return ActivityHigh
+	case dailyMessages >= 20:
+		return ActivityMedium
+	case dailyMessages > 0:
+		return ActivityLow
+	default:
+		return ActivityInactive
+	}
+}
+
+// trackActivity counts a message the bot sees in a group or channel
+func trackActivity(ctx context.Context, chatID, userID int64) {
+	if !activityTrackingEnabled {
+		return
+	}
+	activity.track(chatID, userID, time.Now())
+}
+
+// startActivityFlusher flushes the tracked activities to dynamodb periodically until ctx is done
+func startActivityFlusher(ctx context.Context) {
+	if !activityTrackingEnabled {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(activityFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				activity.flush(ctx)
+			case <-ctx.Done():
+				activity.flush(context.Background())
+				return
+			}
+		}
+	}()
+}
+
+func init() {
+	activityTrackingEnabled = os.Getenv("ACTIVITY_TRACKING") == "true"
+	if v, err := strconv.Atoi(os.Getenv("ACTIVITY_FLUSH_SECONDS")); err == nil && v > 0 {
+		activityFlushInterval = time.Duration(v) * time.Second
+	}
+	if activityTrackingEnabled {
+		baseLogger.Info().Dur("flush_interval", activityFlushInterval).Msg("activity tracking enabled")
+	}
+}
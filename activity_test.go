@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActivityTracker(t *testing.T) {
+	tracker := newActivityTracker()
+	now := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+
+	tracker.track(-1001, 1, now)
+	tracker.track(-1001, 1, now)
+	tracker.track(-1001, 2, now)
+	tracker.track(-1001, 0, now) // channel posts have no user
+	tracker.track(-1001, 1, now.Add(24*time.Hour))
+
+	groups := tracker.take()
+	today := groups[activityKey{chatID: -1001, day: "20211120"}]
+	if today == nil || today.messages != 4 || len(today.users) != 2 {
+		t.Fatalf("unexpected activity of the day: %+v", today)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expect activities of 2 days, got %d", len(groups))
+	}
+	if len(tracker.take()) != 0 {
+		t.Fatal("activities should be cleared after take")
+	}
+}
+
+func TestGetActivityLevel(t *testing.T) {
+	cases := map[int]string{0: ActivityInactive, 1: ActivityLow, 20: ActivityMedium, 150: ActivityHigh}
+	for messages, level := range cases {
+		if got := getActivityLevel(messages); got != level {
+			t.Errorf("getActivityLevel(%d) = %s, want %s", messages, got, level)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// bot admins are the users allowed to run the administrative commands, e.g. reviewing submissions
+var botAdmins = map[int64]bool{}
+
+func isBotAdmin(userID int64) bool {
+	return botAdmins[userID]
+}
+
+func init() {
+	// BOT_ADMINS is a comma separated list of telegram user IDs
+	for _, s := range strings.Split(os.Getenv("BOT_ADMINS"), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			baseLogger.Warn().Str("id", s).Msg("invalid bot admin ID, ignored")
+			continue
+		}
+		botAdmins[id] = true
+	}
+}
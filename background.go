@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// the longest a single backend call may take, configured by *_TIMEOUT_SECONDS
+var (
+	opensearchTimeout = 5 * time.Second
+	dynamodbTimeout   = 3 * time.Second
+	telegramTimeout   = 10 * time.Second
+)
+
+type backgroundKey struct{}
+
+// backgroundWork tracks the goroutines started while handling an update
+type backgroundWork struct {
+	wg sync.WaitGroup
+}
+
+// withBackgroundWork returns a ctx tracking the work started by goBackground, the work is to be waited for
+func withBackgroundWork(ctx context.Context) (context.Context, *backgroundWork) {
+	w := &backgroundWork{}
+	return context.WithValue(ctx, backgroundKey{}, w), w
+}
+
+// wait blocks until the tracked work is finished
+func (w *backgroundWork) wait() {
+	w.wg.Wait()
+}
+
+// goBackground runs fn concurrently with the caller, tracked by the work of ctx,
+// or synchronously if ctx tracks none so nothing is left running unnoticed
+func goBackground(ctx context.Context, fn func(ctx context.Context)) {
+	w, ok := ctx.Value(backgroundKey{}).(*backgroundWork)
+	if !ok {
+		fn(ctx)
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		fn(ctx)
+	}()
+}
+
+// jobGroup runs the long running work started by the updates, e.g. the broadcasts, which outlives
+// the update and is only cancelled when the process shuts down
+type jobGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// the jobs of the process, stopped on shutdown
+var jobs = newJobGroup()
+
+func newJobGroup() *jobGroup {
+	g := &jobGroup{}
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	return g
+}
+
+// start runs fn as a job, it carries the values of ctx, e.g. the logger and the span, but isn't cancelled with it.
+// The job is neither part of the update's background work nor of its request, which are over before the job.
+func (g *jobGroup) start(ctx context.Context, fn func(ctx context.Context)) {
+	values := context.WithValue(context.WithValue(ctx, backgroundKey{}, nil), requestKey{}, false)
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		fn(valuesContext{Context: g.ctx, values: values})
+	}()
+}
+
+// stop cancels the jobs and waits for them to return
+func (g *jobGroup) stop() {
+	g.cancel()
+	g.wg.Wait()
+}
+
+type requestKey struct{}
+
+// withRequest marks ctx as handling an HTTP request, e.g. a webhook update, whose process may be
+// frozen or stopped once it's answered
+func withRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestKey{}, true)
+}
+
+// inRequest tells whether ctx handles an HTTP request, nothing is to be left running after it then
+func inRequest(ctx context.Context) bool {
+	in, _ := ctx.Value(requestKey{}).(bool)
+	return in
+}
+
+// valuesContext is cancelled with its Context but carries the values, e.g. the logger and the span,
+// of another one, for the work outliving the ctx it was started with
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+// cancelBody cancels the request's timeout once its response is read
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// withRequestTimeout limits the request to the timeout, including reading its response
+func withRequestTimeout(req *http.Request, timeout time.Duration, do func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	rsp, err := do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return rsp, err
+	}
+	rsp.Body = cancelBody{ReadCloser: rsp.Body, cancel: cancel}
+	return rsp, nil
+}
+
+func init() {
+	for env, timeout := range map[string]*time.Duration{
+		"OPENSEARCH_TIMEOUT_SECONDS": &opensearchTimeout,
+		"DYNAMODB_TIMEOUT_SECONDS":   &dynamodbTimeout,
+		"TELEGRAM_TIMEOUT_SECONDS":   &telegramTimeout,
+	} {
+		if v, err := strconv.Atoi(os.Getenv(env)); err == nil && v > 0 {
+			*timeout = time.Duration(v) * time.Second
+		}
+	}
+}
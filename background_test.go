@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackgroundWork(t *testing.T) {
+	ctx, work := withBackgroundWork(context.Background())
+	var done int32
+	for i := 0; i < 3; i++ {
+		goBackground(ctx, func(ctx context.Context) {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&done, 1)
+		})
+	}
+	work.wait()
+	if n := atomic.LoadInt32(&done); n != 3 {
+		t.Errorf("got %d finished, want 3", n)
+	}
+
+	// without tracking the work is done synchronously
+	ran := false
+	goBackground(context.Background(), func(ctx context.Context) { ran = true })
+	if !ran {
+		t.Error("untracked work didn't run")
+	}
+}
+
+type ctxKey struct{}
+
+func TestValuesContext(t *testing.T) {
+	values := context.WithValue(context.Background(), ctxKey{}, "update")
+	cancelled, cancel := context.WithCancel(values)
+	cancel()
+
+	ctx := valuesContext{Context: context.Background(), values: cancelled}
+	if ctx.Value(ctxKey{}) != "update" {
+		t.Error("value not carried")
+	}
+	if ctx.Err() != nil {
+		t.Error("cancelled with the values' ctx")
+	}
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	var reqCtx context.Context
+	do := func(req *http.Request) (*http.Response, error) {
+		reqCtx = req.Context()
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	rsp, err := withRequestTimeout(req, time.Minute, do)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reqCtx.Deadline(); !ok {
+		t.Fatal("no deadline on the request")
+	}
+	// the response can be read until it's closed
+	if reqCtx.Err() != nil {
+		t.Fatal("cancelled before the response is read")
+	}
+	rsp.Body.Close()
+	if reqCtx.Err() != context.Canceled {
+		t.Errorf("got %v after closing the response, want canceled", reqCtx.Err())
+	}
+}
+
+func TestJobGroup(t *testing.T) {
+	g := newJobGroup()
+	ctx, work := withBackgroundWork(withRequest(context.WithValue(context.Background(), ctxKey{}, "update")))
+	ctx, cancel := context.WithCancel(ctx)
+
+	started := make(chan context.Context)
+	var stopped int32
+	g.start(ctx, func(ctx context.Context) {
+		started <- ctx
+		<-ctx.Done()
+		atomic.StoreInt32(&stopped, 1)
+	})
+	jobCtx := <-started
+	cancel()
+	work.wait()
+
+	if jobCtx.Value(ctxKey{}) != "update" {
+		t.Error("value not carried")
+	}
+	if inRequest(jobCtx) {
+		t.Error("the job is taken as part of the request")
+	}
+	if _, tracked := jobCtx.Value(backgroundKey{}).(*backgroundWork); tracked {
+		t.Error("the job is tracked by the update's background work")
+	}
+	if jobCtx.Err() != nil {
+		t.Fatal("the job is cancelled with the update's ctx")
+	}
+
+	g.stop()
+	if atomic.LoadInt32(&stopped) != 1 {
+		t.Error("stop returned before the job")
+	}
+}
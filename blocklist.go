@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// blocklist entry kinds
+const (
+	BlockKindUsername = "username" // a glob pattern of group usernames, e.g. *casino*
+	BlockKindChatID   = "chat"     // a group chat ID
+	BlockKindKeyword  = "keyword"  // a keyword in the group title or description
+)
+
+const (
+	blocklistKey      = "blocklist"
+	blocklistCacheTTL = time.Minute
+)
+
+func validBlockKind(kind string) bool {
+	return kind == BlockKindUsername || kind == BlockKindChatID || kind == BlockKindKeyword
+}
+
+func newBlockEntry(kind, value string) BlockEntry {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return BlockEntry{
+		Entry: kind + ":" + value,
+		Kind:  kind,
+		Value: value,
+	}
+}
+
+// getBlocklist returns all the blocklist entries, the list is small so we keep it cached
+func getBlocklist(ctx context.Context) []BlockEntry {
+	if x, found := mcache.Get(blocklistKey); found {
+		return x.([]BlockEntry)
+	}
+	entries := ddbListBlocklist(ctx)
+	mcache.Set(blocklistKey, entries, blocklistCacheTTL)
+	return entries
+}
+
+// matchBlockEntry reports whether the group matches the entry
+func matchBlockEntry(e BlockEntry, g GroupRecord) bool {
+	switch e.Kind {
+	case BlockKindUsername:
+		matched, _ := path.Match(e.Value, strings.ToLower(g.Username))
+		return matched
+	case BlockKindChatID:
+		return e.Value == strconv.FormatInt(g.ChatID, 10)
+	case BlockKindKeyword:
+		return strings.Contains(strings.ToLower(g.Title), e.Value) || strings.Contains(strings.ToLower(g.Description), e.Value)
+	}
+	return false
+}
+
+// checkBlocklist finds the first blocklist entry the group matches
+func checkBlocklist(ctx context.Context, g GroupRecord) (BlockEntry, bool) {
+	for _, e := range getBlocklist(ctx) {
+		if matchBlockEntry(e, g) {
+			return e, true
+		}
+	}
+	return BlockEntry{}, false
+}
+
+// removeBlockedGroups removes the stored groups matching the new entry, they were indexed before it's added
+func removeBlockedGroups(ctx context.Context, e BlockEntry) int {
+	blocked := []int64{}
+	err := ddbScanGroups(ctx, func(g GroupRecord) {
+		if matchBlockEntry(e, g) {
+			blocked = append(blocked, g.ChatID)
+		}
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("entry", e.Entry).Msg("scan groups for the blocklist")
+	}
+	for _, chatID := range blocked {
+		deleteGroup(ctx, chatID)
+		ddbDeleteModeration(ctx, chatID)
+	}
+	return len(blocked)
+}
+
+// parseBlockArgs parses "<kind> <value>" of the block commands
+func parseBlockArgs(args string) (string, string, bool) {
+	fields := strings.Fields(args)
+	if len(fields) < 2 || !validBlockKind(fields[0]) {
+		return "", "", false
+	}
+	value := strings.Join(fields[1:], " ")
+	if fields[0] == BlockKindChatID {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "", "", false
+		}
+	}
+	if fields[0] == BlockKindUsername {
+		if _, err := path.Match(value, ""); err != nil {
+			return "", "", false
+		}
+	}
+	return fields[0], value, true
+}
+
+// blockCommandHandler handles /block, /unblock and /blocklist
+func blockCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	defer clearState(s.ChatID)
+
+	if update.Message == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+
+	if !isBotAdmin(update.Message.From.ID) {
+		sendText(ctx, chatID, getLocalizedText(ctx, PermissionDenied))
+		return
+	}
+
+	if s.Command == "blocklist" {
+		entries := getBlocklist(ctx)
+		if len(entries) == 0 {
+			sendText(ctx, chatID, getLocalizedText(ctx, BlocklistEmpty))
+			return
+		}
+		content := ""
+		for _, e := range entries {
+			content += fmt.Sprintf("%s %s\n", e.Kind, e.Value)
+		}
+		sendText(ctx, chatID, content)
+		return
+	}
+
+	kind, value, ok := parseBlockArgs(update.Message.CommandArguments())
+	if !ok {
+		sendText(ctx, chatID, getLocalizedText(ctx, BlockUsage))
+		return
+	}
+
+	e := newBlockEntry(kind, value)
+	if s.Command == "block" {
+		e.CreatedBy = update.Message.From.ID
+		e.CreatedAt = time.Now().Unix()
+		ddbWriteBlockEntry(ctx, e)
+	} else {
+		ddbDeleteBlockEntry(ctx, e)
+	}
+	mcache.Delete(blocklistKey)
+	logger(ctx).Info().Str("entry", e.Entry).Int64("admin_id", update.Message.From.ID).Msg("blocklist updated")
+
+	sendText(ctx, chatID, getLocalizedText(ctx, BlocklistUpdated))
+	if s.Command == "block" {
+		if removed := removeBlockedGroups(ctx, e); removed > 0 {
+			logger(ctx).Info().Str("entry", e.Entry).Int("removed", removed).Msg("blocked groups removed")
+			sendText(ctx, chatID, fmt.Sprintf(getLocalizedText(ctx, BlockedGroupsRemoved), removed))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestMatchBlockEntry(t *testing.T) {
+	g := GroupRecord{
+		Username:    "Best_Casino_Club",
+		ChatID:      -1001234,
+		Title:       "Best Casino",
+		Description: "free BONUS every day",
+	}
+
+	cases := []struct {
+		entry BlockEntry
+		match bool
+	}{
+		{newBlockEntry(BlockKindUsername, "*casino*"), true},
+		{newBlockEntry(BlockKindUsername, "casino*"), false},
+		{newBlockEntry(BlockKindChatID, "-1001234"), true},
+		{newBlockEntry(BlockKindChatID, "-1001235"), false},
+		{newBlockEntry(BlockKindKeyword, "Bonus"), true},
+		{newBlockEntry(BlockKindKeyword, "lottery"), false},
+	}
+	for _, c := range cases {
+		if got := matchBlockEntry(c.entry, g); got != c.match {
+			t.Errorf("matchBlockEntry(%s) = %v, want %v", c.entry.Entry, got, c.match)
+		}
+	}
+}
+
+func TestParseBlockArgs(t *testing.T) {
+	if _, _, ok := parseBlockArgs("keyword"); ok {
+		t.Error("value missing but parsed")
+	}
+	if _, _, ok := parseBlockArgs("color red"); ok {
+		t.Error("unknown kind but parsed")
+	}
+	if _, _, ok := parseBlockArgs("chat abc"); ok {
+		t.Error("invalid chat ID but parsed")
+	}
+	kind, value, ok := parseBlockArgs("keyword free money")
+	if !ok || kind != BlockKindKeyword || value != "free money" {
+		t.Errorf("parseBlockArgs = %s %s %v", kind, value, ok)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// broadcast status
+const (
+	BroadcastDraft    = "draft"
+	BroadcastRunning  = "running"
+	BroadcastPaused   = "paused"
+	BroadcastDone     = "done"
+	BroadcastCanceled = "canceled"
+)
+
+// delivery results
+const (
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliveryBlocked = "blocked"
+	DeliverySkipped = "skipped"
+)
+
+// broadcast callback operations
+const (
+	broadcastLanguage = "lang"
+	broadcastSend     = "send"
+	broadcastPause    = "pause"
+	broadcastResume   = "resume"
+	broadcastCancel   = "cancel"
+)
+
+const (
+	broadcastRate           = 10 // messages per second, leaves room for the replies to the users
+	broadcastReportInterval = 10 * time.Second
+	broadcastPollInterval   = time.Second // how often a paused broadcast checks whether it's resumed
+)
+
+// the language segments a broadcast targets, empty for all the users
+var broadcastLanguages = []string{"", "zh", "en"}
+
+// matchBroadcastLanguage tells whether the user of the telegram language code, e.g. zh-hans, is targeted
+func matchBroadcastLanguage(language, languageCode string) bool {
+	if language == "" {
+		return true
+	}
+	code := strings.ToLower(languageCode)
+	return code == language || strings.HasPrefix(code, language+"-")
+}
+
+// broadcastJob controls a running broadcast
+type broadcastJob struct {
+	mu       sync.Mutex
+	paused   bool
+	canceled bool
+}
+
+func (j *broadcastJob) set(paused, canceled bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.paused, j.canceled = paused, canceled
+}
+
+// wait blocks while the job is paused, returns false if it's canceled
+func (j *broadcastJob) wait(ctx context.Context) bool {
+	for {
+		j.mu.Lock()
+		paused, canceled := j.paused, j.canceled
+		j.mu.Unlock()
+		if canceled {
+			return false
+		}
+		if !paused {
+			return true
+		}
+
+		select {
+		case <-time.After(broadcastPollInterval):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+var (
+	broadcastJobsMu sync.Mutex
+	broadcastJobs   = map[string]*broadcastJob{}
+)
+
+func getBroadcastJob(id string) *broadcastJob {
+	broadcastJobsMu.Lock()
+	defer broadcastJobsMu.Unlock()
+	return broadcastJobs[id]
+}
+
+// runBroadcast delivers the broadcast to the targeted users as a job, the users delivered before, e.g. by
+// the run interrupted by a restart, are skipped. On shutdown the job saves its progress and stops, leaving
+// the broadcast running to be resumed by the next start.
+func runBroadcast(ctx context.Context, b BroadcastRecord) {
+	broadcastJobsMu.Lock()
+	if _, running := broadcastJobs[b.ID]; running {
+		broadcastJobsMu.Unlock()
+		return
+	}
+	job := &broadcastJob{}
+	broadcastJobs[b.ID] = job
+	broadcastJobsMu.Unlock()
+
+	jobs.start(ctx, func(ctx context.Context) {
+		defer func() {
+			broadcastJobsMu.Lock()
+			delete(broadcastJobs, b.ID)
+			broadcastJobsMu.Unlock()
+		}()
+
+		// the counters saved last may lag behind the deliveries of an interrupted run
+		if counts, err := ddbCountDeliveries(ctx, b.ID); err == nil {
+			b.Sent, b.Failed, b.Blocked, b.Skipped = counts[DeliverySent], counts[DeliveryFailed], counts[DeliveryBlocked], counts[DeliverySkipped]
+		} else {
+			logger(ctx).Error().Err(err).Str("broadcast_id", b.ID).Msg("count deliveries")
+		}
+
+		bucket := newTokenBucket(1, broadcastRate)
+		lastReport := time.Now()
+		completed := true
+		err := ddbScanUsers(ctx, func(u UserRecord) bool {
+			if !job.wait(ctx) {
+				completed = false
+				return false
+			}
+			if !matchBroadcastLanguage(b.Language, u.LanguageCode) || ddbGetDelivery(ctx, b.ID, u.ID) {
+				return true
+			}
+
+			d := DeliveryRecord{BroadcastID: b.ID, UserID: u.ID}
+			if u.Inactive {
+				d.Result = DeliverySkipped
+				b.Skipped++
+			} else {
+				select {
+				case <-time.After(bucket.reserve(time.Now())):
+				case <-ctx.Done():
+					completed = false
+					return false
+				}
+				msg := tgbotapi.NewMessage(u.ID, b.Text)
+				msg.ParseMode = tgbotapi.ModeHTML
+				outcome, err := deliverMessage(ctx, u.ID, msg)
+				if ctx.Err() != nil {
+					// interrupted by the shutdown, the user is left to the resumed run
+					completed = false
+					return false
+				}
+				switch outcome {
+				case sendDone:
+					d.Result = DeliverySent
+					b.Sent++
+				case sendRecipientGone:
+					d.Result = DeliveryBlocked
+					b.Blocked++
+				default:
+					d.Result = DeliveryFailed
+					b.Failed++
+				}
+				if err != nil {
+					d.Error = err.Error()
+				}
+			}
+			d.At = time.Now().Unix()
+			ddbWriteDelivery(ctx, d)
+
+			if time.Since(lastReport) > broadcastReportInterval {
+				lastReport = time.Now()
+				// keep the status set by pause or cancel
+				if latest, found := ddbGetBroadcast(ctx, b.ID); found {
+					b.Status = latest.Status
+				}
+				ddbWriteBroadcast(ctx, b)
+				editBroadcastControl(ctx, b)
+			}
+			return true
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				logger(ctx).Error().Err(err).Str("broadcast_id", b.ID).Msg("broadcast")
+			}
+			completed = false
+		}
+
+		// the progress is saved even if the job is stopped by the shutdown
+		ctx = valuesContext{Context: context.Background(), values: ctx}
+		if latest, found := ddbGetBroadcast(ctx, b.ID); found {
+			b.Status = latest.Status
+		}
+		if completed {
+			b.Status = BroadcastDone
+		}
+		ddbWriteBroadcast(ctx, b)
+		editBroadcastControl(ctx, b)
+		logger(ctx).Info().Str("broadcast_id", b.ID).Str("status", b.Status).Int("sent", b.Sent).Int("failed", b.Failed).
+			Int("blocked", b.Blocked).Int("skipped", b.Skipped).Msg("broadcast stopped")
+	})
+}
+
+// resumeBroadcasts restarts the broadcasts which were running when the bot stopped
+func resumeBroadcasts(ctx context.Context) {
+	for _, b := range ddbListBroadcasts(ctx, BroadcastRunning) {
+		logger(ctx).Info().Str("broadcast_id", b.ID).Msg("resume broadcast")
+		runBroadcast(ctx, b)
+	}
+}
+
+func getLocalizedLanguage(ctx context.Context, language string) string {
+	if language == "" {
+		return getLocalizedText(ctx, BroadcastAllUsers)
+	}
+	return language
+}
+
+func formatBroadcastControl(ctx context.Context, b BroadcastRecord) string {
+	return fmt.Sprintf(getLocalizedText(ctx, BroadcastControl), b.ID, getLocalizedLanguage(ctx, b.Language), b.Status, b.Sent, b.Failed, b.Blocked, b.Skipped)
+}
+
+// broadcastKeyboard has the operations allowed in the broadcast's status
+func broadcastKeyboard(ctx context.Context, b BroadcastRecord) tgbotapi.InlineKeyboardMarkup {
+	cancel := tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, BroadcastCancelButton), newCallbackData(CallbackBroadcast, b.ID, broadcastCancel))
+	switch b.Status {
+	case BroadcastDraft:
+		languages := []tgbotapi.InlineKeyboardButton{}
+		for _, l := range broadcastLanguages {
+			text := getLocalizedLanguage(ctx, l)
+			if l == b.Language {
+				text = "✅ " + text
+			}
+			languages = append(languages, tgbotapi.NewInlineKeyboardButtonData(text, newCallbackData(CallbackBroadcast, b.ID, broadcastLanguage, l)))
+		}
+		return tgbotapi.NewInlineKeyboardMarkup(
+			languages,
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, BroadcastSendButton), newCallbackData(CallbackBroadcast, b.ID, broadcastSend)),
+				cancel,
+			),
+		)
+	case BroadcastRunning:
+		return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, BroadcastPauseButton), newCallbackData(CallbackBroadcast, b.ID, broadcastPause)),
+			cancel,
+		))
+	case BroadcastPaused:
+		return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, BroadcastResumeButton), newCallbackData(CallbackBroadcast, b.ID, broadcastResume)),
+			cancel,
+		))
+	default:
+		return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	}
+}
+
+// editBroadcastControl reports the status and progress of the broadcast on its control message
+func editBroadcastControl(ctx context.Context, b BroadcastRecord) {
+	if b.ControlMessageID == 0 {
+		return
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(b.ControlChatID, b.ControlMessageID, formatBroadcastControl(ctx, b), broadcastKeyboard(ctx, b))
+	if _, err := botSend(ctx, edit); err != nil {
+		logger(ctx).Error().Err(err).Str("broadcast_id", b.ID).Msg("edit broadcast control")
+	}
+}
+
+// broadcastCommandHandler handles /broadcast, the message comes along with the command or in the next message,
+// it's previewed with a control message to choose the target and send
+func broadcastCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	if update.Message == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+
+	if !isBotAdmin(update.Message.From.ID) {
+		clearState(s.ChatID)
+		sendText(ctx, chatID, getLocalizedText(ctx, PermissionDenied))
+		return
+	}
+
+	text := update.Message.Text
+	if s.Stage == CommandReceived {
+		text = update.Message.CommandArguments()
+	}
+	if strings.TrimSpace(text) == "" {
+		s.Stage = BroadcastTextReceived
+		writeState(s)
+		sendText(ctx, chatID, getLocalizedText(ctx, InputBroadcastText))
+		return
+	}
+	clearState(s.ChatID)
+
+	b := BroadcastRecord{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		Text:      text,
+		Status:    BroadcastDraft,
+		CreatedBy: update.Message.From.ID,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	// the preview is exactly what the users will receive
+	preview := tgbotapi.NewMessage(chatID, b.Text)
+	preview.ParseMode = tgbotapi.ModeHTML
+	if _, err := botSend(ctx, preview); err != nil {
+		logger(ctx).Error().Err(err).Msg("preview broadcast")
+		sendText(ctx, chatID, fmt.Sprintf(getLocalizedText(ctx, BroadcastInvalid), err))
+		return
+	}
+
+	control := tgbotapi.NewMessage(chatID, formatBroadcastControl(ctx, b))
+	control.ReplyMarkup = broadcastKeyboard(ctx, b)
+	m, err := botSend(ctx, control)
+	if err != nil {
+		logger(ctx).Error().Err(err).Msg("send broadcast control")
+		return
+	}
+	b.ControlChatID, b.ControlMessageID = chatID, m.MessageID
+	ddbWriteBroadcast(ctx, b)
+}
+
+// broadcastCallbackHandler controls a broadcast, args are the broadcast ID, the operation and its value
+func broadcastCallbackHandler(ctx context.Context, update *tgbotapi.Update, args []string) {
+	query := update.CallbackQuery
+	if !isBotAdmin(query.From.ID) {
+		answerCallback(ctx, update, getLocalizedText(ctx, PermissionDenied))
+		return
+	}
+	defer answerCallback(ctx, update, "")
+	if len(args) < 2 {
+		return
+	}
+
+	b, found := ddbGetBroadcast(ctx, args[0])
+	if !found {
+		return
+	}
+
+	switch args[1] {
+	case broadcastLanguage:
+		if b.Status != BroadcastDraft || len(args) < 3 {
+			return
+		}
+		b.Language = args[2]
+	case broadcastSend:
+		if b.Status != BroadcastDraft {
+			return
+		}
+		// written ahead of the job, which may finish right away
+		b.Status = BroadcastRunning
+		ddbWriteBroadcast(ctx, b)
+		editBroadcastControl(ctx, b)
+		runBroadcast(ctx, b)
+		return
+	case broadcastPause:
+		if b.Status != BroadcastRunning {
+			return
+		}
+		b.Status = BroadcastPaused
+		if job := getBroadcastJob(b.ID); job != nil {
+			job.set(true, false)
+		}
+	case broadcastResume:
+		if b.Status != BroadcastPaused {
+			return
+		}
+		b.Status = BroadcastRunning
+		ddbWriteBroadcast(ctx, b)
+		editBroadcastControl(ctx, b)
+		// the job is gone if the bot restarted while paused
+		if job := getBroadcastJob(b.ID); job != nil {
+			job.set(false, false)
+		} else {
+			runBroadcast(ctx, b)
+		}
+		return
+	case broadcastCancel:
+		if b.Status == BroadcastDone || b.Status == BroadcastCanceled {
+			return
+		}
+		b.Status = BroadcastCanceled
+		if job := getBroadcastJob(b.ID); job != nil {
+			job.set(false, true)
+		}
+	default:
+		return
+	}
+
+	ddbWriteBroadcast(ctx, b)
+	editBroadcastControl(ctx, b)
+}
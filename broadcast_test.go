@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestMatchBroadcastLanguage(t *testing.T) {
+	cases := []struct {
+		language, code string
+		want           bool
+	}{
+		{"", "", true},
+		{"", "en", true},
+		{"zh", "zh-hans", true},
+		{"zh", "ZH", true},
+		{"zh", "en", false},
+		{"en", "", false},
+		{"en", "eng", false},
+	}
+	for _, c := range cases {
+		if got := matchBroadcastLanguage(c.language, c.code); got != c.want {
+			t.Errorf("matchBroadcastLanguage(%q, %q) = %v, want %v", c.language, c.code, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CallbackHandler handles an inline button click which isn't part of a command's state machine,
+// args are the colon separated fields of the callback data following the action
+type CallbackHandler func(ctx context.Context, update *tgbotapi.Update, args []string)
+
+// callback actions, the callback data is formatted as "<action>:<arg1>:<arg2>..."
+const (
+	CallbackModeration   = "mod"
+	CallbackReport       = "rep"
+	CallbackRank         = "rank"
+	CallbackCategory     = "cat"
+	CallbackSubscription = "sub"
+	CallbackGroup        = "grp"
+	CallbackSimilar      = "sim"
+	CallbackMyGroup      = "my"
+	CallbackBroadcast    = "bc"
+)
+
+// the most bytes telegram accepts as the callback data of a button
+const callbackDataLimit = 64
+
+func newCallbackData(action string, args ...string) string {
+	return strings.Join(append([]string{action}, args...), ":")
+}
+
+func getCallbackHandler(action string) CallbackHandler {
+	switch action {
+	case CallbackModeration:
+		return moderationCallbackHandler
+	case CallbackReport:
+		return reportCallbackHandler
+	case CallbackRank:
+		return rankCallbackHandler
+	case CallbackCategory:
+		return categoryCallbackHandler
+	case CallbackSubscription:
+		return subscriptionCallbackHandler
+	case CallbackGroup:
+		return groupCallbackHandler
+	case CallbackSimilar:
+		return similarCallbackHandler
+	case CallbackMyGroup:
+		return myGroupCallbackHandler
+	case CallbackBroadcast:
+		return broadcastCallbackHandler
+	default:
+		return nil
+	}
+}
+
+// handleCallback dispatches the callback query to its handler, returns false if no handler accepts it
+func handleCallback(ctx context.Context, update *tgbotapi.Update) bool {
+	fields := strings.Split(update.CallbackQuery.Data, ":")
+	h := getCallbackHandler(fields[0])
+	if h == nil {
+		return false
+	}
+	h(ctx, update, fields[1:])
+	return true
+}
+
+// answerCallback stops the loading animation of the clicked button, text is shown as a toast if not empty
+func answerCallback(ctx context.Context, update *tgbotapi.Update, text string) {
+	_, err := botRequest(ctx, tgbotapi.NewCallback(update.CallbackQuery.ID, text))
+	if err != nil {
+		logger(ctx).Error().Err(err).Msg("answer callback")
+	}
+}
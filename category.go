@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Category is a node of the category tree, groups are assigned to the categories by Name
+type Category struct {
+	Name     string            `json:"name"`
+	Texts    map[string]string `json:"texts"` // localized button texts
+	Children []Category        `json:"children,omitempty"`
+}
+
+// the root categories, a flat tree of the topics unless configured by CATEGORY_TREE_FILE
+var categoryTree []Category
+
+func defaultCategoryTree() []Category {
+	tree := []Category{}
+	for _, topic := range []string{TopicProgramming, TopicPolitics, TopicEconomics, TopicTechnology, TopicCryptocurrencies, TopicBlockchain} {
+		tree = append(tree, Category{Name: topic, Texts: TopicKeyboardTexts[topic]})
+	}
+	return tree
+}
+
+// findCategory finds the category by name in the tree, along with its parent, nil if it's a root category
+func findCategory(tree []Category, name string, parent *Category) (*Category, *Category) {
+	for i := range tree {
+		c := &tree[i]
+		if c.Name == name {
+			return c, parent
+		}
+		if found, p := findCategory(c.Children, name, c); found != nil {
+			return found, p
+		}
+	}
+	return nil, nil
+}
+
+// findCategoryFold finds the category by name case-insensitively
+func findCategoryFold(tree []Category, name string) *Category {
+	for i := range tree {
+		c := &tree[i]
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+		if found := findCategoryFold(c.Children, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// categoryNames returns the names of the category and all of its descendants
+func categoryNames(c *Category) []string {
+	names := []string{c.Name}
+	for i := range c.Children {
+		names = append(names, categoryNames(&c.Children[i])...)
+	}
+	return names
+}
+
+func getLocalizedCategory(ctx context.Context, c *Category) string {
+	if t, ok := c.Texts["zh"]; ok {
+		return t
+	}
+	return c.Name
+}
+
+// categoryKeyboard shows the categories to choose from, with a button listing all the groups
+// of the parent category and a back button unless it's the root
+func categoryKeyboard(ctx context.Context, categories []Category, parent *Category) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	row := []tgbotapi.InlineKeyboardButton{}
+	for i := range categories {
+		c := &categories[i]
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(getLocalizedCategory(ctx, c), newCallbackData(CallbackCategory, c.Name)))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = []tgbotapi.InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	if parent != nil {
+		_, grandparent := findCategory(categoryTree, parent.Name, nil)
+		back := ""
+		if grandparent != nil {
+			back = grandparent.Name
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, CategoryAll), newCallbackData(CallbackCategory, parent.Name, "0")),
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, Back), newCallbackData(CallbackCategory, back)),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// categoryListKeyboard pages the groups of the category, with a back button to where it's chosen
+func categoryListKeyboard(ctx context.Context, c *Category, parent *Category, page, total int) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	if pages := pageKeyboard(CallbackCategory, page, total, rankPageSize, c.Name); pages != nil {
+		rows = append(rows, pages.InlineKeyboard...)
+	}
+
+	// a category with children is chosen from its own keyboard, otherwise from the parent's
+	back := ""
+	if len(c.Children) > 0 {
+		back = c.Name
+	} else if parent != nil {
+		back = parent.Name
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, Back), newCallbackData(CallbackCategory, back)),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func categoriesCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	defer clearState(s.ChatID)
+
+	if update.Message == nil {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, getLocalizedText(ctx, CategoryChoosing))
+	msg.ReplyMarkup = categoryKeyboard(ctx, categoryTree, nil)
+	if _, err := botSend(ctx, msg); err != nil {
+		logger(ctx).Error().Err(err).Msg("send categories")
+	}
+}
+
+// categoryCallbackHandler navigates the category tree, args are the category name, empty for the root,
+// and the page if the groups of the category are listed
+func categoryCallbackHandler(ctx context.Context, update *tgbotapi.Update, args []string) {
+	defer answerCallback(ctx, update, "")
+
+	query := update.CallbackQuery
+	if len(args) < 1 || query.Message == nil {
+		return
+	}
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+
+	var edit tgbotapi.EditMessageTextConfig
+	c, parent := findCategory(categoryTree, args[0], nil)
+	switch {
+	case c == nil:
+		// back to the root
+		edit = tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, getLocalizedText(ctx, CategoryChoosing), categoryKeyboard(ctx, categoryTree, nil))
+	case len(c.Children) > 0 && len(args) < 2:
+		// drill into the subcategories
+		edit = tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, getLocalizedCategory(ctx, c), categoryKeyboard(ctx, c.Children, c))
+	default:
+		page := 0
+		if len(args) > 1 {
+			page, _ = strconv.Atoi(args[1])
+		}
+		if page < 0 || page >= rankMaxPages {
+			return
+		}
+
+		p := getRankPage(ctx, RankTop, c.Name, page)
+		logSearch(ctx, SearchSourceCategory, nil, c.Name, page, p.total)
+		content := getLocalizedCategory(ctx, c) + "\n\n" + formatGroupList(p.groups, page*rankPageSize)
+		if len(p.groups) == 0 {
+			content = getLocalizedCategory(ctx, c) + "\n\n" + getLocalizedText(ctx, RankEmpty)
+		}
+		edit = tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, content, categoryListKeyboard(ctx, c, parent, page, p.total))
+		edit.ParseMode = tgbotapi.ModeHTML
+		edit.DisableWebPagePreview = true
+	}
+
+	if _, err := botSend(ctx, edit); err != nil {
+		logger(ctx).Error().Err(err).Msg("edit category")
+	}
+}
+
+// the longest callback data a category name goes into is the /mygroups one setting the category
+var maxCategoryNameLength = callbackDataLimit - len(newCallbackData(CallbackMyGroup, strconv.FormatInt(math.MinInt64, 10), myGroupSetCategory, ""))
+
+// validateCategoryTree checks the category names fit into the callback data of the buttons
+func validateCategoryTree(tree []Category) error {
+	for _, c := range flattenCategories(tree) {
+		if c.Name == "" {
+			return fmt.Errorf("category with no name")
+		}
+		if strings.Contains(c.Name, ":") {
+			return fmt.Errorf("category %q: the name can't contain ':'", c.Name)
+		}
+		if len(c.Name) > maxCategoryNameLength {
+			return fmt.Errorf("category %q: the name is longer than %d bytes", c.Name, maxCategoryNameLength)
+		}
+	}
+	return nil
+}
+
+func init() {
+	categoryTree = defaultCategoryTree()
+
+	path := os.Getenv("CATEGORY_TREE_FILE")
+	if path == "" {
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		baseLogger.Fatal().Err(err).Str("path", path).Msg("unable to read category tree")
+	}
+	tree := []Category{}
+	if err := json.Unmarshal(content, &tree); err != nil {
+		baseLogger.Fatal().Err(err).Str("path", path).Msg("invalid category tree")
+	}
+	if err := validateCategoryTree(tree); err != nil {
+		baseLogger.Fatal().Err(err).Str("path", path).Msg("invalid category tree")
+	}
+	categoryTree = tree
+}
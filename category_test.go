@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindCategory(t *testing.T) {
+	tree := []Category{
+		{Name: "Tech", Children: []Category{
+			{Name: "Programming", Children: []Category{{Name: "Go"}, {Name: "Rust"}}},
+			{Name: "Gadgets"},
+		}},
+		{Name: "Politics"},
+	}
+
+	c, parent := findCategory(tree, "Go", nil)
+	if c == nil || parent == nil || parent.Name != "Programming" {
+		t.Fatalf("findCategory(Go) = %v, %v", c, parent)
+	}
+	if c, parent := findCategory(tree, "Politics", nil); c == nil || parent != nil {
+		t.Fatalf("root category should have no parent, got %v, %v", c, parent)
+	}
+	if c, _ := findCategory(tree, "Sports", nil); c != nil {
+		t.Fatalf("unknown category found: %v", c)
+	}
+	if c := findCategoryFold(tree, "gadgets"); c == nil || c.Name != "Gadgets" {
+		t.Fatalf("findCategoryFold(gadgets) = %v", c)
+	}
+
+	tech, _ := findCategory(tree, "Tech", nil)
+	want := []string{"Tech", "Programming", "Go", "Rust", "Gadgets"}
+	if names := categoryNames(tech); !reflect.DeepEqual(names, want) {
+		t.Errorf("categoryNames(Tech) = %v, want %v", names, want)
+	}
+}
+
+func TestValidateCategoryTree(t *testing.T) {
+	if err := validateCategoryTree(defaultCategoryTree()); err != nil {
+		t.Fatalf("default tree: %v", err)
+	}
+
+	long := strings.Repeat("x", maxCategoryNameLength)
+	if err := validateCategoryTree([]Category{{Name: "Tech", Children: []Category{{Name: long}}}}); err != nil {
+		t.Fatalf("name of %d bytes: %v", len(long), err)
+	}
+	if data := newCallbackData(CallbackMyGroup, "-9223372036854775808", myGroupSetCategory, long); len(data) > callbackDataLimit {
+		t.Fatalf("callback data %q is %d bytes", data, len(data))
+	}
+
+	for _, tree := range [][]Category{
+		{{Name: "Tech", Children: []Category{{Name: "C:C++"}}}},
+		{{Name: long + "x"}},
+		{{Name: ""}},
+	} {
+		if err := validateCategoryTree(tree); err == nil {
+			t.Errorf("validateCategoryTree(%v) accepted", tree)
+		}
+	}
+}
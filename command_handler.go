@@ -2,15 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cifer76/gojieba"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/jdkato/prose/v2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type CommandHandler func(ctx context.Context, update *tgbotapi.Update, state *CommandState)
@@ -26,10 +30,26 @@ const (
 	GroupLinkReceived  = "GroupLinkReceived"
 	GroupTopicReceived = "GroupTopicReceived"
 	GroupTagsReceived  = "GroupTagsReceived"
+
+	// report command specific
+	ReportLinkReceived = "ReportLinkReceived"
+
+	// subscribe command specific
+	SubscribeKeywordsReceived = "SubscribeKeywordsReceived"
+
+	// mygroups command specific
+	MyGroupTagsReceived = "MyGroupTagsReceived"
+
+	// broadcast command specific
+	BroadcastTextReceived = "BroadcastTextReceived"
 )
 
+// the group doesn't exist, or is invisible to the bot
+var errGroupNotFound = errors.New("GroupNotFound")
+
 var (
 	patternGroupUsername *regexp.Regexp // group username must be only letters, numbers and underscore
+	patternInviteLink    *regexp.Regexp // private group invite link, t.me/+hash or t.me/joinchat/hash
 	patternGroupTag      *regexp.Regexp // group tag can be CJK characters and english letters
 	patternGroupCategory *regexp.Regexp // group category can be CJK characters and english letters
 
@@ -81,10 +101,37 @@ func getCheckGroupUsername(userInput string) string {
 	return groupUsername
 }
 
+// getCheckInviteLink extracts the hash of a private group invite link, i.e. t.me/+hash or t.me/joinchat/hash
+func getCheckInviteLink(userInput string) string {
+	m := patternInviteLink.FindStringSubmatch(strings.TrimSpace(userInput))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
 func getGroupInfo(ctx context.Context, groupUsername string) (tgbotapi.Chat, int, error) {
-	chatConfig := tgbotapi.ChatConfig{
+	ctx, span := startSpan(ctx, "getGroupInfo", attribute.String("group_username", groupUsername))
+	chat, count, err := getChatInfo(ctx, tgbotapi.ChatConfig{
 		// must be proceeded with @, refer to: https://core.telegram.org/bots/api#getchat
 		SuperGroupUsername: "@" + groupUsername,
+	})
+	endSpan(span, err)
+	return chat, count, err
+}
+
+// getGroupInfoByID queries groups without username, i.e. private groups, the bot must be in the group
+func getGroupInfoByID(ctx context.Context, chatID int64) (tgbotapi.Chat, int, error) {
+	ctx, span := startSpan(ctx, "getGroupInfo", attribute.Int64("group_id", chatID))
+	chat, count, err := getChatInfo(ctx, tgbotapi.ChatConfig{ChatID: chatID})
+	endSpan(span, err)
+	return chat, count, err
+}
+
+func getChatInfo(ctx context.Context, chatConfig tgbotapi.ChatConfig) (tgbotapi.Chat, int, error) {
+	name := chatConfig.SuperGroupUsername
+	if name == "" {
+		name = strconv.FormatInt(chatConfig.ChatID, 10)
 	}
 
 	// query group info
@@ -92,8 +139,12 @@ func getGroupInfo(ctx context.Context, groupUsername string) (tgbotapi.Chat, int
 		ChatConfig: chatConfig,
 	})
 	if err != nil {
-		log.Printf("getChat for %s error: %v\n", groupUsername, err)
-		return chat, 0, fmt.Errorf("GroupNotFound")
+		logger(ctx).Error().Err(err).Str("group_username", name).Msg("getChat")
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest {
+			return chat, 0, errGroupNotFound
+		}
+		return chat, 0, fmt.Errorf("getChat for %s: %w", name, err)
 	}
 
 	// get chat member count
@@ -101,12 +152,30 @@ func getGroupInfo(ctx context.Context, groupUsername string) (tgbotapi.Chat, int
 		ChatConfig: chatConfig,
 	})
 	if err != nil {
-		log.Printf("getChatMembersCount for %s error: %v\n", groupUsername, err)
+		logger(ctx).Error().Err(err).Str("group_username", name).Msg("getChatMembersCount")
 	}
 
 	return chat, count, nil
 }
 
+// createInviteLink creates an invite link of the bot's own for a private group,
+// the bot must be an administrator with the invite users permission
+func createInviteLink(ctx context.Context, chatID int64) (string, error) {
+	rsp, err := botRequest(ctx, tgbotapi.CreateChatInviteLinkConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+		Name:       "TeleEye",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	link := tgbotapi.ChatInviteLink{}
+	if err := json.Unmarshal(rsp.Result, &link); err != nil {
+		return "", err
+	}
+	return link.InviteLink, nil
+}
+
 func getGroupTagsCN(ctx context.Context, title, desc string) []string {
 	// get tags using gojieba
 	tags := jieba.CutForSearch(title, true)
@@ -192,7 +261,7 @@ func getGroupTagsEng(ctx context.Context, title, description string) []string {
 	// Create a new document with the default configuration:
 	doc, err := prose.NewDocument(docstring)
 	if err != nil {
-		log.Println(err)
+		logger(ctx).Error().Err(err).Msg("tokenize")
 		return []string{}
 	}
 
@@ -223,10 +292,7 @@ func addCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandS
 	defer func() {
 		msg := tgbotapi.NewMessage(chatID, content)
 		msg.DisableWebPagePreview = true
-		_, err := bot.Send(msg)
-		if err != nil {
-			log.Println(err)
-		}
+		queueMessage(ctx, msg)
 		if s.Stage == Done {
 			clearState(s.ChatID)
 		} else {
@@ -239,6 +305,15 @@ func addCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandS
 		s.Stage = GroupLinkReceived
 		content = getLocalizedText(ctx, InputGroupLink)
 	case GroupLinkReceived:
+		countStat(StatAddAttempts, 1)
+
+		// the bot API can't look up a group by its invite link, the group has to add the bot instead
+		if getCheckInviteLink(message) != "" {
+			s.Stage = Done
+			content = getLocalizedText(ctx, PrivateGroupAddBot)
+			return
+		}
+
 		groupUsername := getCheckGroupUsername(message)
 		if groupUsername == "" {
 			content = getLocalizedText(ctx, UsernameInvalid)
@@ -251,21 +326,54 @@ func addCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandS
 			content = getLocalizedText(ctx, GroupNotFound)
 			return
 		}
-		fmt.Printf("New group, ID: %v, name: %s, type: %s, memberCount: %d, description: %s\n", s.Chat.ID, s.Chat.Title, s.Chat.Type, s.MemberCount, s.Chat.Description)
+		logger(ctx).Info().Int64("group_id", s.Chat.ID).Str("type", s.Chat.Type).Int("member_count", s.MemberCount).Msg("new group")
 
 		//s.Tags = getGroupTags(ctx, s.Chat.Title, s.Chat.Description)
 		s.Stage = Done
 
-		go opensearchWriteGroup(ctx, GroupRecord{
+		record := GroupRecord{
 			Username:    s.UserName,
 			ChatID:      s.ID,
 			Title:       s.Title,
 			Type:        s.Type,
 			Description: s.Description,
 			MemberCount: s.MemberCount,
-		})
+			Category:    s.Category,
+		}
 
-		content = fmt.Sprintf(getLocalizedText(ctx, IndexSuccess), s.Title, s.Description, time.Now().Format("2006/01/02 15:04:05"))
+		var (
+			requesterID int64
+			reason      string
+		)
+		if requester := getUserFromUpdate(update); requester != nil {
+			requesterID = requester.ID
+		}
+		if requireGroupOwnership {
+			record.Verification = VerificationUnverified
+			if requesterID != 0 {
+				record.Verification = verifyGroupOwnership(ctx, s.ID, requesterID)
+			}
+			// not the owner, leave it to the bot admins, or refuse it if nobody can review it
+			if record.Verification != VerificationVerified {
+				if !moderationEnabled() {
+					content = getLocalizedText(ctx, OwnershipFailed)
+					return
+				}
+				reason = ModerationReasonUnverified
+			}
+		}
+
+		switch submitGroup(ctx, record, requesterID, reason) {
+		case GroupStatusBlocked:
+			content = getLocalizedText(ctx, GroupBlocked)
+			return
+		case GroupStatusPending:
+			countStat(StatAddPending, 1)
+			content = fmt.Sprintf(getLocalizedText(ctx, IndexPendingReview), s.Title)
+		default:
+			countStat(StatAddSuccesses, 1)
+			content = fmt.Sprintf(getLocalizedText(ctx, IndexSuccess), s.Title, s.Description, time.Now().Format("2006/01/02 15:04:05"))
+		}
 	default:
 	}
 }
@@ -280,20 +388,18 @@ func startCommandHandler(ctx context.Context, update *tgbotapi.Update, s *Comman
 	if updateIsCommand(update) && update.Message.Command() == "start" {
 		tguser := update.Message.From
 		userRecord := UserRecord{
-			ID:        tguser.ID,
-			Username:  tguser.UserName,
-			FirstName: tguser.FirstName,
-			LastName:  tguser.LastName,
+			ID:           tguser.ID,
+			Username:     tguser.UserName,
+			FirstName:    tguser.FirstName,
+			LastName:     tguser.LastName,
+			LanguageCode: tguser.LanguageCode,
 		}
-		go ddbWriteUser(ctx, userRecord)
+		goBackground(ctx, func(ctx context.Context) { ddbWriteUser(ctx, userRecord) })
 	}
 
 	chatID := update.Message.Chat.ID
 	content := getStartContent(ctx)
-	_, err := bot.Send(tgbotapi.NewMessage(chatID, content))
-	if err != nil {
-		log.Println(err)
-	}
+	queueMessage(ctx, tgbotapi.NewMessage(chatID, content))
 
 	clearState(s.ChatID)
 }
@@ -302,6 +408,30 @@ func getCommandHandler(command string) CommandHandler {
 	switch command {
 	case "add":
 		return addCommandHandler
+	case "pending":
+		return pendingCommandHandler
+	case "report":
+		return reportCommandHandler
+	case "block", "unblock", "blocklist":
+		return blockCommandHandler
+	case RankTop, RankTrending:
+		return rankCommandHandler
+	case "categories":
+		return categoriesCommandHandler
+	case "group":
+		return groupCommandHandler
+	case "subscribe":
+		return subscribeCommandHandler
+	case "unsubscribe", "subscriptions":
+		return unsubscribeCommandHandler
+	case "mygroups":
+		return myGroupsCommandHandler
+	case "broadcast":
+		return broadcastCommandHandler
+	case "stats":
+		return statsCommandHandler
+	case "searchlog":
+		return searchLogCommandHandler
 	default:
 		return startCommandHandler
 	}
@@ -309,6 +439,7 @@ func getCommandHandler(command string) CommandHandler {
 
 func init() {
 	patternGroupUsername = regexp.MustCompile("^[a-zA-Z]+[0-9_a-zA-Z]+$")
+	patternInviteLink = regexp.MustCompile(`^(?:https?://)?t\.me/(?:\+|joinchat/)([0-9a-zA-Z_-]+)/?$`)
 	patternGroupTag = regexp.MustCompile("^[\u4e00-\u9fa5a-zA-Z0-9._]+$")
 	patternGroupCategory = regexp.MustCompile("^[\u4e00-\u9fa5a-zA-Z0-9]+$")
 	jieba = gojieba.NewJieba()
@@ -33,3 +33,17 @@ func TestGetGroupTagsCN(t *testing.T) {
 	fmt.Println(tags)
 
 }
+
+func TestGetCheckInviteLink(t *testing.T) {
+	cases := map[string]string{
+		"https://t.me/+AbC-d_e1":         "AbC-d_e1",
+		"t.me/joinchat/AAAAAEkk2WdoDrB4": "AAAAAEkk2WdoDrB4",
+		"https://t.me/nightyworld":       "",
+		"nightyworld":                    "",
+	}
+	for input, hash := range cases {
+		if got := getCheckInviteLink(input); got != hash {
+			t.Errorf("getCheckInviteLink(%s) = %s, want %s", input, got, hash)
+		}
+	}
+}
@@ -22,14 +22,34 @@ type CommandState struct {
 	Stage   string `json:"stage"` // the current stage
 }
 
+// group ownership verification status
+const (
+	VerificationVerified   = "verified"   // the requester is the creator or an administrator of the group
+	VerificationUnverified = "unverified" // the requester's ownership couldn't be confirmed
+)
+
 // Group Record
 type GroupRecord struct {
-	Username    string `json:"username"`
-	ChatID      int64  `json:"chat_id" dynamodbav:"chat_id"`
-	Title       string `json:"title"`
-	Type        string `json:"type"`
-	Description string `json:"description"`
-	MemberCount int    `json:"member_count" dynamodbav:"member_count"`
+	Username     string   `json:"username" dynamodbav:"username"`
+	ChatID       int64    `json:"chat_id" dynamodbav:"chat_id"`
+	Title        string   `json:"title" dynamodbav:"title"`
+	Type         string   `json:"type" dynamodbav:"type"`
+	Description  string   `json:"description" dynamodbav:"description"`
+	MemberCount  int      `json:"member_count" dynamodbav:"member_count"`
+	MemberGrowth int      `json:"member_growth" dynamodbav:"member_growth"` // member count growth over the snapshots of the recent days
+	Category     string   `json:"category,omitempty" dynamodbav:"category,omitempty"`
+	Tags         []string `json:"tags,omitempty" dynamodbav:"tags,stringset,omitempty"`
+	CreatedAt    int64    `json:"created_at,omitempty" dynamodbav:"created_at,omitempty"`   // when the group is indexed
+	UpdatedAt    int64    `json:"updated_at,omitempty" dynamodbav:"updated_at,omitempty"`   // when the group is refreshed last time
+	InviteLink   string   `json:"invite_link,omitempty" dynamodbav:"invite_link,omitempty"` // the bot created invite link of a private group
+	Verification string   `json:"verification,omitempty" dynamodbav:"verification,omitempty"`
+	Status       string   `json:"status,omitempty" dynamodbav:"status,omitempty"`             // moderation status, only approved groups are searchable
+	SubmitterID  int64    `json:"submitter_id,omitempty" dynamodbav:"submitter_id,omitempty"` // who submitted the group through /add or by adding the bot
+
+	// activity of the recent days, only available when activity tracking is enabled
+	Activity         string `json:"activity,omitempty" dynamodbav:"activity,omitempty"`
+	DailyMessages    int    `json:"daily_messages,omitempty" dynamodbav:"daily_messages,omitempty"`
+	DailyActiveUsers int    `json:"daily_active_users,omitempty" dynamodbav:"daily_active_users,omitempty"`
 }
 
 // GroupRecords implements sort.Interface based on the MemberCount field.
@@ -39,17 +59,130 @@ func (a GroupRecords) Len() int           { return len(a) }
 func (a GroupRecords) Less(i, j int) bool { return a[i].MemberCount > a[j].MemberCount }
 func (a GroupRecords) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
-// Tag Record
+// Tag Record, the chat IDs of the groups of the tag
 type TagRecord struct {
-	Tag    string
-	Groups []string
+	Tag    string   `dynamodbav:"tag"`
+	Groups []string `dynamodbav:"groups,stringset,omitempty"`
+}
+
+// Outbox Record, a change of the group in the groups table yet to be synced to the search index
+type OutboxRecord struct {
+	ChatID  int64 `dynamodbav:"chat_id"`
+	Version int64 `dynamodbav:"version"` // when the change is made in unix nanoseconds, a newer change replaces the record
+}
+
+// Moderation Record, a group submission waiting for a bot admin to review
+type ModerationRecord struct {
+	ChatID      int64       `dynamodbav:"chat_id"`
+	Group       GroupRecord `dynamodbav:"group"`
+	SubmitterID int64       `dynamodbav:"submitter_id"`
+	Reason      string      `dynamodbav:"reason"` // why the submission isn't indexed directly
+	CreatedAt   int64       `dynamodbav:"created_at"`
+}
+
+// Report Record, a user's report on a group, each user reports a group at most once
+type ReportRecord struct {
+	ChatID     int64  `dynamodbav:"chat_id"`
+	ReporterID int64  `dynamodbav:"reporter_id"`
+	Reason     string `dynamodbav:"reason"`
+	CreatedAt  int64  `dynamodbav:"created_at"`
+}
+
+// Block Entry, keeps the matching groups out of the index
+type BlockEntry struct {
+	Entry     string `dynamodbav:"entry"` // "<kind>:<value>", the key
+	Kind      string `dynamodbav:"kind"`
+	Value     string `dynamodbav:"value"`
+	CreatedBy int64  `dynamodbav:"created_by"`
+	CreatedAt int64  `dynamodbav:"created_at"`
+}
+
+// Activity Record, the activity of a group within a day
+type ActivityRecord struct {
+	ChatID   int64   `dynamodbav:"chat_id"`
+	Day      string  `dynamodbav:"day"` // yyyymmdd in UTC
+	Messages int     `dynamodbav:"messages"`
+	Users    []int64 `dynamodbav:"users,numberset,omitempty"` // the distinct active users
+	ExpireAt int64   `dynamodbav:"expire_at"`                 // TTL attribute
+}
+
+// Snapshot Record, the member count of a group taken at a refresh, one per day
+type SnapshotRecord struct {
+	ChatID      int64  `dynamodbav:"chat_id"`
+	Day         string `dynamodbav:"day"` // yyyymmdd in UTC
+	MemberCount int    `dynamodbav:"member_count"`
+	ExpireAt    int64  `dynamodbav:"expire_at"` // TTL attribute
+}
+
+// Subscription Record, a user wants to be alerted of the new groups matching the keywords
+type SubscriptionRecord struct {
+	UserID    int64  `dynamodbav:"user_id"`
+	Keywords  string `dynamodbav:"keywords"` // normalized, space separated
+	CreatedAt int64  `dynamodbav:"created_at"`
+}
+
+// Notified Record, the user has been alerted of the group
+type NotifiedRecord struct {
+	UserID   int64 `dynamodbav:"user_id"`
+	ChatID   int64 `dynamodbav:"chat_id"`
+	ExpireAt int64 `dynamodbav:"expire_at"` // TTL
 }
 
 // User Record
 type UserRecord struct {
-	ID           int64
-	Username     string
-	FirstName    string
-	LastName     string
-	LanguageCode string
+	ID           int64  `dynamodbav:"id"`
+	Username     string `dynamodbav:"username"`
+	FirstName    string `dynamodbav:"first_name"`
+	LastName     string `dynamodbav:"last_name"`
+	LanguageCode string `dynamodbav:"language_code"`
+	Inactive     bool   `dynamodbav:"inactive"` // blocked the bot or deactivated, messages can't be delivered
+}
+
+// Stat Record, a usage counter of a day
+type StatRecord struct {
+	Day      string `dynamodbav:"day"` // yyyymmdd in UTC
+	Metric   string `dynamodbav:"metric"`
+	Count    int    `dynamodbav:"count"`
+	ExpireAt int64  `dynamodbav:"expire_at"` // TTL attribute
+}
+
+// Search Log Record, a search or a page of the browsed groups
+type SearchLogRecord struct {
+	Day       string  `dynamodbav:"day"` // yyyymmdd in UTC
+	ID        string  `dynamodbav:"id"`
+	Source    string  `dynamodbav:"source"`            // search, top, trending or category
+	Query     string  `dynamodbav:"query,omitempty"`   // the normalized keywords
+	Filters   string  `dynamodbav:"filters,omitempty"` // the group type or category browsed
+	Page      int     `dynamodbav:"page"`
+	Results   int     `dynamodbav:"results"`
+	Clicks    []int64 `dynamodbav:"clicks,numberset,omitempty"` // the groups opened from the results
+	CreatedAt int64   `dynamodbav:"created_at"`
+	ExpireAt  int64   `dynamodbav:"expire_at"` // TTL attribute
+}
+
+// Broadcast Record, an announcement of the bot admins to the users
+type BroadcastRecord struct {
+	ID               string `dynamodbav:"id"`
+	Text             string `dynamodbav:"text"`     // in HTML
+	Language         string `dynamodbav:"language"` // language code of the targeted users, empty for all
+	Status           string `dynamodbav:"status"`
+	CreatedBy        int64  `dynamodbav:"created_by"`
+	CreatedAt        int64  `dynamodbav:"created_at"`
+	ControlChatID    int64  `dynamodbav:"control_chat_id"` // the message controlling the broadcast and reporting its progress
+	ControlMessageID int    `dynamodbav:"control_message_id"`
+
+	// delivery results so far
+	Sent    int `dynamodbav:"sent"`
+	Failed  int `dynamodbav:"failed"`
+	Blocked int `dynamodbav:"blocked"` // found blocking the bot during the broadcast
+	Skipped int `dynamodbav:"skipped"` // already known inactive
+}
+
+// Delivery Record, the result of a broadcast to a user
+type DeliveryRecord struct {
+	BroadcastID string `dynamodbav:"broadcast_id"`
+	UserID      int64  `dynamodbav:"user_id"`
+	Result      string `dynamodbav:"result"`
+	Error       string `dynamodbav:"error,omitempty"`
+	At          int64  `dynamodbav:"at"`
 }
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -12,11 +15,28 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// the most items dynamodb takes in a transaction or a batch write
+const (
+	ddbTransactionSize  = 25
+	ddbBatchSize        = 25
+	ddbBatchMaxAttempts = 5 // of the unprocessed writes of a batch
+
+	ddbGroupWriteAttempts = 3 // of a group write racing with the other writes of the group
+)
+
+// the global secondary index of the groups table by submitter_id
+const groupsSubmitterIndex = "submitter_id-index"
+
 var dynsvc *dynamodb.Client
 
 func ddbWriteUser(ctx context.Context, u UserRecord) {
+	ctx, span := startSpan(ctx, "ddbWriteUser", attribute.Int64("user_id", u.ID))
+	defer span.End()
+
 	// write user info
 	_, err := dynsvc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String("users"),
@@ -24,115 +44,1158 @@ func ddbWriteUser(ctx context.Context, u UserRecord) {
 			"id": &types.AttributeValueMemberN{Value: strconv.FormatInt(u.ID, 10)},
 		},
 		ReturnValues:     types.ReturnValueUpdatedOld,
-		UpdateExpression: aws.String("set username = :username, first_name = :first_name, last_name = :last_name, update_at = :update_at, created_at = if_not_exists(created_at, :created_at)"),
+		UpdateExpression: aws.String("set username = :username, first_name = :first_name, last_name = :last_name, language_code = :language_code, update_at = :update_at, inactive = :inactive, created_at = if_not_exists(created_at, :created_at)"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":username":   &types.AttributeValueMemberS{Value: u.Username},
-			":first_name": &types.AttributeValueMemberS{Value: u.FirstName},
-			":last_name":  &types.AttributeValueMemberS{Value: u.LastName},
-			":created_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
-			":update_at":  &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+			":username":      &types.AttributeValueMemberS{Value: u.Username},
+			":first_name":    &types.AttributeValueMemberS{Value: u.FirstName},
+			":last_name":     &types.AttributeValueMemberS{Value: u.LastName},
+			":language_code": &types.AttributeValueMemberS{Value: u.LanguageCode},
+			":created_at":    &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+			":update_at":     &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+			":inactive":      &types.AttributeValueMemberBOOL{Value: false},
 		},
 	})
 	if err != nil {
-		log.Printf("record user %d error: %v\n", u.ID, err)
+		failSpan(span, err)
+		logger(ctx).Error().Err(err).Int64("user_id", u.ID).Msg("record user")
 		return
 	}
 }
 
-func ddbWriteGroup(ctx context.Context, s GroupInfo) {
-	// write group info
-	updatedOldValues, err := dynsvc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-		TableName: aws.String("groups"),
+// ddbScanUsers calls fn with every recorded user until it returns false
+func ddbScanUsers(ctx context.Context, fn func(u UserRecord) bool) error {
+	paginator := dynamodb.NewScanPaginator(dynsvc, &dynamodb.ScanInput{
+		TableName: aws.String("users"),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		page := []UserRecord{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			logger(ctx).Error().Err(err).Msg("unmarshal users")
+			continue
+		}
+		for _, u := range page {
+			if !fn(u) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// ddbMarkUserInactive marks the user who blocked the bot or is deactivated, the user is active again on /start
+func ddbMarkUserInactive(ctx context.Context, userID int64) {
+	_, err := dynsvc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("users"),
 		Key: map[string]types.AttributeValue{
-			"username": &types.AttributeValueMemberS{Value: s.UserName},
-		},
-		ReturnValues:     types.ReturnValueUpdatedOld,
-		UpdateExpression: aws.String("set title = :title, #t = :type, description = :desc, chat_id = :chat_id, member_count = :member_count, category = :category, tags = :tags, update_at = :update_at, created_at = if_not_exists(created_at, :created_at)"),
-		ExpressionAttributeNames: map[string]string{
-			"#t": "type",
+			"id": &types.AttributeValueMemberN{Value: strconv.FormatInt(userID, 10)},
 		},
+		UpdateExpression:    aws.String("set inactive = :inactive, update_at = :update_at"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":title":        &types.AttributeValueMemberS{Value: s.Title},
-			":type":         &types.AttributeValueMemberS{Value: s.Type},
-			":desc":         &types.AttributeValueMemberS{Value: s.Description},
-			":chat_id":      &types.AttributeValueMemberN{Value: strconv.FormatInt(s.ID, 10)},
-			":member_count": &types.AttributeValueMemberN{Value: strconv.Itoa(s.MemberCount)},
-			":created_at":   &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
-			":update_at":    &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
-			":category":     &types.AttributeValueMemberS{Value: s.Category},
-			":tags":         &types.AttributeValueMemberSS{Value: s.Tags},
+			":inactive":  &types.AttributeValueMemberBOOL{Value: true},
+			":update_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
 		},
 	})
+	// users never recorded are left alone
+	var ccf *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &ccf) {
+		logger(ctx).Error().Err(err).Int64("user_id", userID).Msg("mark user inactive")
+	}
+}
+
+// ddbWriteGroup writes the group to the groups table, the system of record of the groups, and moves it
+// between the tags' indexes. It returns the group replaced, nil if the group is new. If the group is written
+// but the tags beyond the first transaction aren't moved, errTagIndex is returned along with the group replaced.
+func ddbWriteGroup(ctx context.Context, r GroupRecord) (*GroupRecord, error) {
+	item, err := attributevalue.MarshalMap(r)
 	if err != nil {
-		log.Printf("index %s error: %v\n", s.UserName, err)
-		return
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		old, condition, values, err := ddbReadGroupForWrite(ctx, r.ChatID)
+		if err != nil {
+			return nil, err
+		}
+		var oldTags []string
+		if old != nil {
+			oldTags = old.Tags
+		}
+		toAdd, toDelete := diffTags(oldTags, r.Tags)
+
+		put := types.TransactWriteItem{Put: &types.Put{
+			TableName:                 aws.String("groups"),
+			Item:                      item,
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeValues: values,
+		}}
+		rest, err := ddbTransactGroup(ctx, put, tagIndexUpdates(r.ChatID, toAdd, toDelete))
+		if ddbGroupChanged(err) && attempt < ddbGroupWriteAttempts {
+			// written by someone else since it's read, diff against the tags it has now
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := ddbTransactWrite(ctx, rest); err != nil {
+			return old, fmt.Errorf("%w: %v", errTagIndex, err)
+		}
+		return old, nil
 	}
+}
 
-	// Write tags(for search) info
-	// In this step, we move the group from the old tags indexes to the new tags'
-	oldTags := []string{}
-	checkOld := map[string]bool{}
-	toDelete := []string{}
-	toAdd := []string{}
-	_ = attributevalue.Unmarshal(updatedOldValues.Attributes["tags"], oldTags)
-	for _, o := range oldTags {
-		checkOld[o] = true
+// ddbReadGroupForWrite reads the stored group, nil if there's none, along with the condition of the group
+// still having the tags read. A write conditioned on it moves the group between the tags' indexes right.
+func ddbReadGroupForWrite(ctx context.Context, chatID int64) (*GroupRecord, string, map[string]types.AttributeValue, error) {
+	output, err := dynsvc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("groups"),
+		Key: map[string]types.AttributeValue{
+			"chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if len(output.Item) == 0 {
+		return nil, "attribute_not_exists(chat_id)", nil, nil
+	}
+	old := &GroupRecord{}
+	if err := attributevalue.UnmarshalMap(output.Item, old); err != nil {
+		return nil, "", nil, err
 	}
-	for _, t := range s.Tags {
-		if _, ok := checkOld[t]; !ok { // if the new tag doesn't overlap with old tags, we need to index the group use the new tag
+	if tags, ok := output.Item["tags"]; ok {
+		return old, "tags = :tags", map[string]types.AttributeValue{":tags": tags}, nil
+	}
+	return old, "attribute_exists(chat_id) and attribute_not_exists(tags)", nil, nil
+}
+
+// ddbTransactGroup makes the write of the group in a transaction along with the first of the tags' updates,
+// so a failed write leaves the tags' indexes as they are. It returns the updates beyond the transaction,
+// which are left to the caller.
+func ddbTransactGroup(ctx context.Context, write types.TransactWriteItem, updates []types.TransactWriteItem) ([]types.TransactWriteItem, error) {
+	n := len(updates)
+	if n > ddbTransactionSize-1 {
+		n = ddbTransactionSize - 1
+	}
+	items := append([]types.TransactWriteItem{write}, updates[:n]...)
+	if _, err := dynsvc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items}); err != nil {
+		return nil, err
+	}
+	return updates[n:], nil
+}
+
+// ddbGroupChanged tells whether the transaction of the group is cancelled, e.g. by the group being written
+// since it's read
+func ddbGroupChanged(err error) bool {
+	var tce *types.TransactionCanceledException
+	return errors.As(err, &tce)
+}
+
+// diffTags tells which tags' indexes the group is to be added to and removed from when its tags change
+func diffTags(oldTags, newTags []string) (toAdd, toDelete []string) {
+	inOld, inNew := map[string]bool{}, map[string]bool{}
+	for _, t := range oldTags {
+		inOld[t] = true
+	}
+	for _, t := range newTags {
+		if !inOld[t] && !inNew[t] {
 			toAdd = append(toAdd, t)
-		} else { // if overlapped, mark the old tag to false for reservation
-			checkOld[t] = false
 		}
+		inNew[t] = true
+	}
+	for _, t := range oldTags {
+		if !inNew[t] {
+			toDelete = append(toDelete, t)
+			// a duplicated old tag is deleted once
+			inNew[t] = true
+		}
+	}
+	return toAdd, toDelete
+}
+
+// tagIndexUpdates adds the group to the tags' indexes of toAdd and removes it from toDelete's
+func tagIndexUpdates(chatID int64, toAdd, toDelete []string) []types.TransactWriteItem {
+	group := &types.AttributeValueMemberSS{Value: []string{strconv.FormatInt(chatID, 10)}}
+	update := func(tag, expr string) types.TransactWriteItem {
+		return types.TransactWriteItem{Update: &types.Update{
+			TableName: aws.String("tags"),
+			Key: map[string]types.AttributeValue{
+				"tag": &types.AttributeValueMemberS{Value: tag},
+			},
+			UpdateExpression:          aws.String(expr),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":group": group},
+		}}
+	}
+	items := make([]types.TransactWriteItem, 0, len(toAdd)+len(toDelete))
+	for _, tag := range toAdd {
+		items = append(items, update(tag, "add groups :group"))
+	}
+	for _, tag := range toDelete {
+		items = append(items, update(tag, "delete groups :group"))
+	}
+	return items
+}
+
+// ddbTransactWrite makes the writes in transactions of up to ddbTransactionSize items
+func ddbTransactWrite(ctx context.Context, items []types.TransactWriteItem) error {
+	for len(items) > 0 {
+		n := len(items)
+		if n > ddbTransactionSize {
+			n = ddbTransactionSize
+		}
+		if _, err := dynsvc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items[:n]}); err != nil {
+			return err
+		}
+		items = items[n:]
+	}
+	return nil
+}
+
+// ddbGetGroup gets the group from the groups table, an error is returned if the table can't tell
+func ddbGetGroup(ctx context.Context, chatID int64) (GroupRecord, bool, error) {
+	r := GroupRecord{}
+	output, err := dynsvc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("groups"),
+		Key: map[string]types.AttributeValue{
+			"chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return r, false, err
+	}
+	if output.Item == nil {
+		return r, false, nil
+	}
+	if err := attributevalue.UnmarshalMap(output.Item, &r); err != nil {
+		return r, false, err
+	}
+	return r, true, nil
+}
+
+// groupUpdateExpression builds the expression setting the fields, which are named as the attributes
+func groupUpdateExpression(fields map[string]interface{}) (string, map[string]string, map[string]types.AttributeValue, error) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sets := make([]string, 0, len(keys))
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	for i, k := range keys {
+		v, err := attributevalue.Marshal(fields[k])
+		if err != nil {
+			return "", nil, nil, err
+		}
+		name, value := "#f"+strconv.Itoa(i), ":v"+strconv.Itoa(i)
+		names[name], values[value] = k, v
+		sets = append(sets, name+" = "+value)
+	}
+	return "set " + strings.Join(sets, ", "), names, values, nil
+}
+
+// ddbUpdateGroup updates some fields of a stored group, it returns errGroupNotStored for the groups not stored
+func ddbUpdateGroup(ctx context.Context, chatID int64, fields map[string]interface{}) error {
+	expr, names, values, err := groupUpdateExpression(fields)
+	if err != nil {
+		return err
+	}
+	_, err = dynsvc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("groups"),
+		Key: map[string]types.AttributeValue{
+			"chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+		},
+		UpdateExpression:          aws.String(expr),
+		ConditionExpression:       aws.String("attribute_exists(chat_id)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return errGroupNotStored
 	}
-	for t, v := range checkOld {
-		if v == false { // we have marked the overlapped tags to false
+	return err
+}
+
+// ddbGroupsTableEmpty tells whether the groups table has no group at all
+func ddbGroupsTableEmpty(ctx context.Context) (bool, error) {
+	output, err := dynsvc.Scan(ctx, &dynamodb.ScanInput{
+		TableName: aws.String("groups"),
+		Limit:     aws.Int32(1),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(output.Items) == 0 && len(output.LastEvaluatedKey) == 0, nil
+}
+
+// ddbDeleteGroup deletes the group from the groups table and the tags' indexes, errTagIndex is returned if
+// the group is deleted but the tags beyond the first transaction aren't
+func ddbDeleteGroup(ctx context.Context, chatID int64) error {
+	for attempt := 1; ; attempt++ {
+		old, condition, values, err := ddbReadGroupForWrite(ctx, chatID)
+		if err != nil || old == nil {
+			return err
+		}
+
+		del := types.TransactWriteItem{Delete: &types.Delete{
+			TableName: aws.String("groups"),
+			Key: map[string]types.AttributeValue{
+				"chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+			},
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeValues: values,
+		}}
+		rest, err := ddbTransactGroup(ctx, del, tagIndexUpdates(chatID, nil, old.Tags))
+		if ddbGroupChanged(err) && attempt < ddbGroupWriteAttempts {
 			continue
 		}
-		toDelete = append(toDelete, t)
-	}
-
-	var wg sync.WaitGroup
-	for _, t := range toAdd {
-		wg.Add(1)
-		go func(tag string) {
-			defer wg.Done()
-			_, err := dynsvc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-				TableName: aws.String("tags"),
-				Key: map[string]types.AttributeValue{
-					"tag": &types.AttributeValueMemberS{Value: tag},
-				},
-				UpdateExpression: aws.String("add groups :group"),
-				ExpressionAttributeValues: map[string]types.AttributeValue{
-					":group": &types.AttributeValueMemberSS{Value: []string{s.UserName}},
-				},
-			})
-			if err != nil {
-				log.Printf("add tag index %s:%s error: %v\n", tag, s.UserName, err)
+		if err != nil {
+			return err
+		}
+		if err := ddbTransactWrite(ctx, rest); err != nil {
+			return fmt.Errorf("%w: %v", errTagIndex, err)
+		}
+		return nil
+	}
+}
+
+// ddbScanGroups calls fn with every stored group
+func ddbScanGroups(ctx context.Context, fn func(g GroupRecord)) error {
+	paginator := dynamodb.NewScanPaginator(dynsvc, &dynamodb.ScanInput{
+		TableName: aws.String("groups"),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		page := []GroupRecord{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return err
+		}
+		for _, g := range page {
+			fn(g)
+		}
+	}
+	return nil
+}
+
+// ddbListSubmittedGroups lists the groups submitted by the user in all statuses, the latest updated first,
+// by the submitter_id-index of the groups table
+func ddbListSubmittedGroups(ctx context.Context, submitterID int64, size int) []GroupRecord {
+	paginator := dynamodb.NewQueryPaginator(dynsvc, &dynamodb.QueryInput{
+		TableName:              aws.String("groups"),
+		IndexName:              aws.String(groupsSubmitterIndex),
+		KeyConditionExpression: aws.String("submitter_id = :submitter_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":submitter_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(submitterID, 10)},
+		},
+	})
+	groups := []GroupRecord{}
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger(ctx).Error().Err(err).Int64("submitter_id", submitterID).Msg("list groups of submitter")
+			return nil
+		}
+		page := []GroupRecord{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			logger(ctx).Error().Err(err).Int64("submitter_id", submitterID).Msg("unmarshal groups of submitter")
+			return nil
+		}
+		groups = append(groups, page...)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].UpdatedAt > groups[j].UpdatedAt })
+	if len(groups) > size {
+		groups = groups[:size]
+	}
+	return groups
+}
+
+// ddbWriteOutbox records a change of the group to be synced to the search index, returning its version
+func ddbWriteOutbox(ctx context.Context, chatID int64) (int64, error) {
+	r := OutboxRecord{ChatID: chatID, Version: time.Now().UnixNano()}
+	item, err := attributevalue.MarshalMap(r)
+	if err != nil {
+		return 0, err
+	}
+	_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("group_outbox"),
+		Item:      item,
+	})
+	return r.Version, err
+}
+
+// ddbDeleteOutbox deletes the synced change, unless a newer change of the group has replaced it
+func ddbDeleteOutbox(ctx context.Context, r OutboxRecord) {
+	_, err := dynsvc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("group_outbox"),
+		Key: map[string]types.AttributeValue{
+			"chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(r.ChatID, 10)},
+		},
+		ConditionExpression: aws.String("version = :version"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(r.Version, 10)},
+		},
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &ccf) {
+		logger(ctx).Error().Err(err).Int64("group_id", r.ChatID).Msg("delete outbox")
+	}
+}
+
+// ddbListOutbox lists the changes yet to be synced
+func ddbListOutbox(ctx context.Context) ([]OutboxRecord, error) {
+	records := []OutboxRecord{}
+	paginator := dynamodb.NewScanPaginator(dynsvc, &dynamodb.ScanInput{
+		TableName: aws.String("group_outbox"),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return records, err
+		}
+		page := []OutboxRecord{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return records, err
+		}
+		records = append(records, page...)
+	}
+	return records, nil
+}
+
+// ddbScanTags lists the tags' indexes
+func ddbScanTags(ctx context.Context) ([]TagRecord, error) {
+	records := []TagRecord{}
+	paginator := dynamodb.NewScanPaginator(dynsvc, &dynamodb.ScanInput{
+		TableName: aws.String("tags"),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return records, err
+		}
+		page := []TagRecord{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return records, err
+		}
+		records = append(records, page...)
+	}
+	return records, nil
+}
+
+// ddbBatchWrite makes the writes to the table in batches of up to ddbBatchSize,
+// retrying the unprocessed ones a few times
+func ddbBatchWrite(ctx context.Context, table string, requests []types.WriteRequest) error {
+	for len(requests) > 0 {
+		n := len(requests)
+		if n > ddbBatchSize {
+			n = ddbBatchSize
+		}
+		pending := map[string][]types.WriteRequest{table: requests[:n]}
+		for attempt := 0; len(pending[table]) > 0; attempt++ {
+			if attempt >= ddbBatchMaxAttempts {
+				return fmt.Errorf("batch write %s: %d writes unprocessed", table, len(pending[table]))
+			}
+			if attempt > 0 {
+				select {
+				case <-time.After(sendBackoff(attempt - 1)):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
 			}
-		}(t)
-	}
-	for _, t := range toDelete {
-		wg.Add(1)
-		go func(tag string) {
-			defer wg.Done()
-			_, err := dynsvc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-				TableName: aws.String("tags"),
-				Key: map[string]types.AttributeValue{
-					"tag": &types.AttributeValueMemberS{Value: tag},
-				},
-				UpdateExpression: aws.String("delete groups :group"),
-				ExpressionAttributeValues: map[string]types.AttributeValue{
-					":group": &types.AttributeValueMemberSS{Value: []string{s.UserName}},
-				},
-			})
+			output, err := dynsvc.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
 			if err != nil {
-				log.Printf("delete tags index %s:%s error: %v\n", tag, s.UserName, err)
+				return err
 			}
-		}(t)
+			pending = output.UnprocessedItems
+		}
+		requests = requests[n:]
+	}
+	return nil
+}
+
+func ddbEnqueueModeration(ctx context.Context, r ModerationRecord) {
+	item, err := attributevalue.MarshalMap(r)
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", r.ChatID).Msg("marshal moderation record")
+		return
+	}
+
+	_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("moderation"),
+		Item:      item,
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", r.ChatID).Msg("enqueue moderation")
+	}
+}
+
+func ddbGetModeration(ctx context.Context, chatID int64) (ModerationRecord, bool) {
+	r := ModerationRecord{}
+	output, err := dynsvc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("moderation"),
+		Key: map[string]types.AttributeValue{
+			"chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("get moderation")
+		return r, false
+	}
+	if output.Item == nil {
+		return r, false
+	}
+	if err := attributevalue.UnmarshalMap(output.Item, &r); err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("unmarshal moderation")
+		return r, false
+	}
+	return r, true
+}
+
+func ddbListModeration(ctx context.Context, limit int32) []ModerationRecord {
+	records := []ModerationRecord{}
+	output, err := dynsvc.Scan(ctx, &dynamodb.ScanInput{
+		TableName: aws.String("moderation"),
+		Limit:     aws.Int32(limit),
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Msg("list moderation")
+		return records
+	}
+	if err := attributevalue.UnmarshalListOfMaps(output.Items, &records); err != nil {
+		logger(ctx).Error().Err(err).Msg("unmarshal moderation list")
+	}
+	return records
+}
+
+func ddbDeleteModeration(ctx context.Context, chatID int64) {
+	_, err := dynsvc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("moderation"),
+		Key: map[string]types.AttributeValue{
+			"chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("delete moderation")
+	}
+}
+
+// ddbWriteReport records the report, returns false if the user has reported the group before
+func ddbWriteReport(ctx context.Context, r ReportRecord) bool {
+	item, err := attributevalue.MarshalMap(r)
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", r.ChatID).Int64("reporter_id", r.ReporterID).Msg("marshal report")
+		return false
+	}
+
+	_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("reports"),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(reporter_id)"),
+	})
+	if err != nil {
+		var conflict *types.ConditionalCheckFailedException
+		if !errors.As(err, &conflict) {
+			logger(ctx).Error().Err(err).Int64("group_id", r.ChatID).Int64("reporter_id", r.ReporterID).Msg("write report")
+		}
+		return false
+	}
+	return true
+}
+
+func ddbCountReports(ctx context.Context, chatID int64) int {
+	paginator := dynamodb.NewQueryPaginator(dynsvc, &dynamodb.QueryInput{
+		TableName:              aws.String("reports"),
+		KeyConditionExpression: aws.String("chat_id = :chat_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+		},
+		Select: types.SelectCount,
+	})
+	count := 0
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("count reports")
+			return count
+		}
+		count += int(output.Count)
+	}
+	return count
+}
+
+func ddbClearReports(ctx context.Context, chatID int64) {
+	paginator := dynamodb.NewQueryPaginator(dynsvc, &dynamodb.QueryInput{
+		TableName:              aws.String("reports"),
+		KeyConditionExpression: aws.String("chat_id = :chat_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+		},
+		ProjectionExpression: aws.String("chat_id, reporter_id"),
+	})
+	requests := []types.WriteRequest{}
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("query reports")
+			return
+		}
+		for _, key := range output.Items {
+			requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}})
+		}
+	}
+	if err := ddbBatchWrite(ctx, "reports", requests); err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("delete reports")
+	}
+}
+
+func ddbListBlocklist(ctx context.Context) []BlockEntry {
+	entries := []BlockEntry{}
+	paginator := dynamodb.NewScanPaginator(dynsvc, &dynamodb.ScanInput{
+		TableName: aws.String("blocklist"),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger(ctx).Error().Err(err).Msg("list blocklist")
+			return entries
+		}
+		page := []BlockEntry{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			logger(ctx).Error().Err(err).Msg("unmarshal blocklist")
+			continue
+		}
+		entries = append(entries, page...)
+	}
+	return entries
+}
+
+func ddbWriteBlockEntry(ctx context.Context, e BlockEntry) {
+	item, err := attributevalue.MarshalMap(e)
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("entry", e.Entry).Msg("marshal blocklist entry")
+		return
+	}
+
+	_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("blocklist"),
+		Item:      item,
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("entry", e.Entry).Msg("write blocklist entry")
+	}
+}
+
+func ddbDeleteBlockEntry(ctx context.Context, e BlockEntry) {
+	_, err := dynsvc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("blocklist"),
+		Key: map[string]types.AttributeValue{
+			"entry": &types.AttributeValueMemberS{Value: e.Entry},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("entry", e.Entry).Msg("delete blocklist entry")
+	}
+}
+
+// ddbAddActivity adds the activity to the group's daily record
+func ddbAddActivity(ctx context.Context, r ActivityRecord) {
+	values := map[string]types.AttributeValue{
+		":messages":  &types.AttributeValueMemberN{Value: strconv.Itoa(r.Messages)},
+		":expire_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(r.ExpireAt, 10)},
+	}
+	expr := "add messages :messages set expire_at = :expire_at"
+	if len(r.Users) > 0 {
+		users := make([]string, 0, len(r.Users))
+		for _, u := range r.Users {
+			users = append(users, strconv.FormatInt(u, 10))
+		}
+		values[":users"] = &types.AttributeValueMemberNS{Value: users}
+		expr = "add messages :messages, #u :users set expire_at = :expire_at"
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String("activity"),
+		Key: map[string]types.AttributeValue{
+			"chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(r.ChatID, 10)},
+			"day":     &types.AttributeValueMemberS{Value: r.Day},
+		},
+		UpdateExpression:          aws.String(expr),
+		ExpressionAttributeValues: values,
+	}
+	if len(r.Users) > 0 {
+		input.ExpressionAttributeNames = map[string]string{"#u": "users"}
+	}
+
+	if _, err := dynsvc.UpdateItem(ctx, input); err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", r.ChatID).Str("day", r.Day).Msg("add activity")
+	}
+}
+
+// ddbGetActivity gets the group's daily records since the day
+func ddbGetActivity(ctx context.Context, chatID int64, since string) []ActivityRecord {
+	records := []ActivityRecord{}
+	output, err := dynsvc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("activity"),
+		KeyConditionExpression: aws.String("chat_id = :chat_id and #d >= :since"),
+		ExpressionAttributeNames: map[string]string{
+			"#d": "day",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+			":since":   &types.AttributeValueMemberS{Value: since},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("get activity")
+		return records
+	}
+	if err := attributevalue.UnmarshalListOfMaps(output.Items, &records); err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("unmarshal activity")
+	}
+	return records
+}
+
+func ddbWriteSnapshot(ctx context.Context, r SnapshotRecord) {
+	item, err := attributevalue.MarshalMap(r)
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", r.ChatID).Str("day", r.Day).Msg("marshal snapshot")
+		return
+	}
+
+	_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("snapshots"),
+		Item:      item,
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", r.ChatID).Str("day", r.Day).Msg("write snapshot")
+	}
+}
+
+// ddbGetSnapshots gets the group's snapshots since the day, in time order
+func ddbGetSnapshots(ctx context.Context, chatID int64, since string) []SnapshotRecord {
+	records := []SnapshotRecord{}
+	output, err := dynsvc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("snapshots"),
+		KeyConditionExpression: aws.String("chat_id = :chat_id and #d >= :since"),
+		ExpressionAttributeNames: map[string]string{
+			"#d": "day",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+			":since":   &types.AttributeValueMemberS{Value: since},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("get snapshots")
+		return records
+	}
+	if err := attributevalue.UnmarshalListOfMaps(output.Items, &records); err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("unmarshal snapshots")
 	}
-	wg.Wait()
+	return records
+}
+
+// ddbGetOldestSnapshot gets the group's oldest snapshot since the day
+func ddbGetOldestSnapshot(ctx context.Context, chatID int64, since string) (SnapshotRecord, bool) {
+	r := SnapshotRecord{}
+	output, err := dynsvc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("snapshots"),
+		KeyConditionExpression: aws.String("chat_id = :chat_id and #d >= :since"),
+		ExpressionAttributeNames: map[string]string{
+			"#d": "day",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+			":since":   &types.AttributeValueMemberS{Value: since},
+		},
+		ScanIndexForward: aws.Bool(true),
+		Limit:            aws.Int32(1),
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("get snapshot")
+		return r, false
+	}
+	if len(output.Items) == 0 {
+		return r, false
+	}
+	if err := attributevalue.UnmarshalMap(output.Items[0], &r); err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("unmarshal snapshot")
+		return r, false
+	}
+	return r, true
+}
+
+func ddbListSubscriptions(ctx context.Context) []SubscriptionRecord {
+	subs := []SubscriptionRecord{}
+	paginator := dynamodb.NewScanPaginator(dynsvc, &dynamodb.ScanInput{
+		TableName: aws.String("subscriptions"),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger(ctx).Error().Err(err).Msg("list subscriptions")
+			return subs
+		}
+		page := []SubscriptionRecord{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			logger(ctx).Error().Err(err).Msg("unmarshal subscriptions")
+			continue
+		}
+		subs = append(subs, page...)
+	}
+	return subs
+}
+
+func ddbGetSubscriptions(ctx context.Context, userID int64) []SubscriptionRecord {
+	subs := []SubscriptionRecord{}
+	output, err := dynsvc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("subscriptions"),
+		KeyConditionExpression: aws.String("user_id = :user_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":user_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(userID, 10)},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("user_id", userID).Msg("get subscriptions")
+		return subs
+	}
+	if err := attributevalue.UnmarshalListOfMaps(output.Items, &subs); err != nil {
+		logger(ctx).Error().Err(err).Int64("user_id", userID).Msg("unmarshal subscriptions")
+	}
+	return subs
+}
 
+func ddbWriteSubscription(ctx context.Context, sub SubscriptionRecord) {
+	item, err := attributevalue.MarshalMap(sub)
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("user_id", sub.UserID).Msg("marshal subscription")
+		return
+	}
+
+	_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("subscriptions"),
+		Item:      item,
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("user_id", sub.UserID).Msg("write subscription")
+	}
+}
+
+func ddbDeleteSubscription(ctx context.Context, userID int64, keywords string) {
+	_, err := dynsvc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("subscriptions"),
+		Key: map[string]types.AttributeValue{
+			"user_id":  &types.AttributeValueMemberN{Value: strconv.FormatInt(userID, 10)},
+			"keywords": &types.AttributeValueMemberS{Value: keywords},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("user_id", userID).Msg("delete subscription")
+	}
+}
+
+// ddbNotified tells whether the user has been alerted of the group within the retention, the expired records
+// may linger until dynamodb's TTL deletes them
+func ddbNotified(ctx context.Context, userID, chatID int64) bool {
+	output, err := dynsvc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("notified"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(userID, 10)},
+			"chat_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(chatID, 10)},
+		},
+	})
+	if err != nil {
+		// rather miss an alert than repeat one
+		logger(ctx).Error().Err(err).Int64("user_id", userID).Int64("group_id", chatID).Msg("get notified")
+		return true
+	}
+	r := NotifiedRecord{}
+	if output.Item == nil || attributevalue.UnmarshalMap(output.Item, &r) != nil {
+		return false
+	}
+	return r.ExpireAt > time.Now().Unix()
+}
+
+// ddbMarkNotified records that the user is alerted of the group until expireAt
+func ddbMarkNotified(ctx context.Context, userID, chatID int64, expireAt int64) {
+	item, err := attributevalue.MarshalMap(NotifiedRecord{UserID: userID, ChatID: chatID, ExpireAt: expireAt})
+	if err == nil {
+		_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String("notified"),
+			Item:      item,
+		})
+	}
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("user_id", userID).Int64("group_id", chatID).Msg("mark notified")
+	}
+}
+
+func ddbAddStat(ctx context.Context, r StatRecord) {
+	_, err := dynsvc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("stats"),
+		Key: map[string]types.AttributeValue{
+			"day":    &types.AttributeValueMemberS{Value: r.Day},
+			"metric": &types.AttributeValueMemberS{Value: r.Metric},
+		},
+		UpdateExpression:         aws.String("add #c :count set expire_at = :expire_at"),
+		ExpressionAttributeNames: map[string]string{"#c": "count"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":count":     &types.AttributeValueMemberN{Value: strconv.Itoa(r.Count)},
+			":expire_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(r.ExpireAt, 10)},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("day", r.Day).Str("metric", r.Metric).Msg("add stat")
+	}
+}
+
+// ddbGetStats gets all the counters of the day
+func ddbGetStats(ctx context.Context, day string) []StatRecord {
+	records := []StatRecord{}
+	output, err := dynsvc.Query(ctx, &dynamodb.QueryInput{
+		TableName:                aws.String("stats"),
+		KeyConditionExpression:   aws.String("#d = :day"),
+		ExpressionAttributeNames: map[string]string{"#d": "day"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":day": &types.AttributeValueMemberS{Value: day},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("day", day).Msg("get stats")
+		return records
+	}
+	if err := attributevalue.UnmarshalListOfMaps(output.Items, &records); err != nil {
+		logger(ctx).Error().Err(err).Str("day", day).Msg("unmarshal stats")
+	}
+	return records
+}
+
+// ddbMarkDailyUser records the user active on the day, returns false if it's been recorded
+func ddbMarkDailyUser(ctx context.Context, day string, userID int64, expireAt int64) bool {
+	_, err := dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("daily_users"),
+		Item: map[string]types.AttributeValue{
+			"day":       &types.AttributeValueMemberS{Value: day},
+			"user_id":   &types.AttributeValueMemberN{Value: strconv.FormatInt(userID, 10)},
+			"expire_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(expireAt, 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(user_id)"),
+	})
+	if err != nil {
+		var conflict *types.ConditionalCheckFailedException
+		if !errors.As(err, &conflict) {
+			logger(ctx).Error().Err(err).Str("day", day).Int64("user_id", userID).Msg("mark daily user")
+		}
+		return false
+	}
+	return true
+}
+
+func ddbWriteSearchLog(ctx context.Context, r SearchLogRecord) {
+	item, err := attributevalue.MarshalMap(r)
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("search_log_id", r.ID).Msg("marshal search log")
+		return
+	}
+
+	_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("search_log"),
+		Item:      item,
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("search_log_id", r.ID).Msg("write search log")
+	}
+}
+
+// ddbAddSearchClick adds the clicked group to the search log record if it's still kept
+func ddbAddSearchClick(ctx context.Context, day, id string, chatID int64) {
+	_, err := dynsvc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("search_log"),
+		Key: map[string]types.AttributeValue{
+			"day": &types.AttributeValueMemberS{Value: day},
+			"id":  &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("add clicks :clicks"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":clicks": &types.AttributeValueMemberNS{Value: []string{strconv.FormatInt(chatID, 10)}},
+		},
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &ccf) {
+		logger(ctx).Error().Err(err).Str("search_log_id", id).Msg("add search click")
+	}
+}
+
+// ddbGetSearchLog gets all the search log records of the day
+func ddbGetSearchLog(ctx context.Context, day string) []SearchLogRecord {
+	records := []SearchLogRecord{}
+	paginator := dynamodb.NewQueryPaginator(dynsvc, &dynamodb.QueryInput{
+		TableName:                aws.String("search_log"),
+		KeyConditionExpression:   aws.String("#d = :day"),
+		ExpressionAttributeNames: map[string]string{"#d": "day"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":day": &types.AttributeValueMemberS{Value: day},
+		},
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger(ctx).Error().Err(err).Str("day", day).Msg("get search log")
+			return records
+		}
+		page := []SearchLogRecord{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			logger(ctx).Error().Err(err).Str("day", day).Msg("unmarshal search log")
+			continue
+		}
+		records = append(records, page...)
+	}
+	return records
+}
+
+func ddbWriteBroadcast(ctx context.Context, b BroadcastRecord) {
+	item, err := attributevalue.MarshalMap(b)
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("broadcast_id", b.ID).Msg("marshal broadcast")
+		return
+	}
+
+	_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("broadcasts"),
+		Item:      item,
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("broadcast_id", b.ID).Msg("write broadcast")
+	}
+}
+
+func ddbGetBroadcast(ctx context.Context, id string) (BroadcastRecord, bool) {
+	b := BroadcastRecord{}
+	output, err := dynsvc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("broadcasts"),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("broadcast_id", id).Msg("get broadcast")
+		return b, false
+	}
+	if output.Item == nil {
+		return b, false
+	}
+	if err := attributevalue.UnmarshalMap(output.Item, &b); err != nil {
+		logger(ctx).Error().Err(err).Str("broadcast_id", id).Msg("unmarshal broadcast")
+		return b, false
+	}
+	return b, true
+}
+
+// ddbListBroadcasts lists the broadcasts in the status, there are only a few of them
+func ddbListBroadcasts(ctx context.Context, status string) []BroadcastRecord {
+	broadcasts := []BroadcastRecord{}
+	paginator := dynamodb.NewScanPaginator(dynsvc, &dynamodb.ScanInput{
+		TableName:                aws.String("broadcasts"),
+		FilterExpression:         aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: status},
+		},
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger(ctx).Error().Err(err).Msg("list broadcasts")
+			return broadcasts
+		}
+		page := []BroadcastRecord{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			logger(ctx).Error().Err(err).Msg("unmarshal broadcasts")
+			continue
+		}
+		broadcasts = append(broadcasts, page...)
+	}
+	return broadcasts
+}
+
+// ddbGetDelivery tells whether the broadcast has been delivered to the user, whatever the result is
+func ddbGetDelivery(ctx context.Context, broadcastID string, userID int64) bool {
+	output, err := dynsvc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("broadcast_deliveries"),
+		Key: map[string]types.AttributeValue{
+			"broadcast_id": &types.AttributeValueMemberS{Value: broadcastID},
+			"user_id":      &types.AttributeValueMemberN{Value: strconv.FormatInt(userID, 10)},
+		},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("broadcast_id", broadcastID).Int64("user_id", userID).Msg("get delivery")
+		return false
+	}
+	return output.Item != nil
+}
+
+func ddbWriteDelivery(ctx context.Context, d DeliveryRecord) {
+	item, err := attributevalue.MarshalMap(d)
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("broadcast_id", d.BroadcastID).Int64("user_id", d.UserID).Msg("marshal delivery")
+		return
+	}
+
+	_, err = dynsvc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("broadcast_deliveries"),
+		Item:      item,
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("broadcast_id", d.BroadcastID).Int64("user_id", d.UserID).Msg("write delivery")
+	}
+}
+
+// ddbCountDeliveries counts the recorded deliveries of the broadcast by result
+func ddbCountDeliveries(ctx context.Context, broadcastID string) (map[string]int, error) {
+	paginator := dynamodb.NewQueryPaginator(dynsvc, &dynamodb.QueryInput{
+		TableName:              aws.String("broadcast_deliveries"),
+		KeyConditionExpression: aws.String("broadcast_id = :broadcast_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":broadcast_id": &types.AttributeValueMemberS{Value: broadcastID},
+		},
+		ProjectionExpression:     aws.String("#r"),
+		ExpressionAttributeNames: map[string]string{"#r": "result"},
+	})
+	counts := map[string]int{}
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		page := []DeliveryRecord{}
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return nil, err
+		}
+		for _, d := range page {
+			counts[d.Result]++
+		}
+	}
+	return counts, nil
+}
+
+// addDynamoDBTimeout adds a middleware limiting every DynamoDB call, retries included, to dynamodbTimeout
+func addDynamoDBTimeout(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Timeout",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			ctx, cancel := context.WithTimeout(ctx, dynamodbTimeout)
+			defer cancel()
+			return next.HandleInitialize(ctx, in)
+		}), middleware.After)
 }
 
 func init() {
@@ -140,11 +1203,17 @@ func init() {
 	// Using the SDK's default configuration, loading additional config
 	// and credentials values from the environment variables, shared
 	// credentials, and shared configuration files
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion("ap-east-1"))
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion("ap-east-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{addDynamoDBMetrics, addDynamoDBTimeout}))
 	if err != nil {
-		log.Fatalf("unable to load SDK config, %v\n", err)
+		baseLogger.Fatal().Err(err).Msg("unable to load SDK config")
 	}
 
 	// Using the Config value, create the DynamoDB client
-	dynsvc = dynamodb.NewFromConfig(cfg)
+	// DYNAMODB_ENDPOINT points the client to another endpoint, e.g. a dynamodb-local for replaying
+	var opts []func(*dynamodb.Options)
+	if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
+		opts = append(opts, dynamodb.WithEndpointResolver(dynamodb.EndpointResolverFromURL(endpoint)))
+	}
+	dynsvc = dynamodb.NewFromConfig(cfg, opts...)
 }
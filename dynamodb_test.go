@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamoDB is an in-process stand-in of dynamodb serving the operations on the groups, tags, outbox
+// and notified tables, the items are kept in the wire format
+type fakeDynamoDB struct {
+	mu           sync.Mutex
+	keys         map[string]string                            // the space separated primary key attributes of each table
+	tables       map[string]map[string]map[string]interface{} // table -> key -> item
+	transactions []int                                        // the number of items of each transaction
+
+	failTransactionsFrom int    // the transactions from this one on, counting from 1, fail if it isn't 0
+	beforeTransaction    func() // called ahead of each transaction, e.g. to make a racing write
+}
+
+var (
+	patternSetUpdate  = regexp.MustCompile(`^(add|delete) (\w+) (:\w+)$`)
+	patternCondition  = regexp.MustCompile(`^(?:(attribute_exists|attribute_not_exists)\((\w+)\)|(\w+) = (:\w+))$`)
+	patternAssignment = regexp.MustCompile(`^([#\w]+) = (:\w+)$`)
+)
+
+// newFakeDynamoDB points dynsvc to a fake until the test ends
+func newFakeDynamoDB(t *testing.T) *fakeDynamoDB {
+	f := &fakeDynamoDB{
+		keys:   map[string]string{"groups": "chat_id", "tags": "tag", "group_outbox": "chat_id", "notified": "user_id chat_id"},
+		tables: map[string]map[string]map[string]interface{}{},
+	}
+	srv := httptest.NewServer(f)
+	saved := dynsvc
+	dynsvc = dynamodb.New(dynamodb.Options{
+		Region:           "local",
+		Credentials:      aws.AnonymousCredentials{},
+		EndpointResolver: dynamodb.EndpointResolverFromURL(srv.URL),
+	})
+	t.Cleanup(func() {
+		dynsvc = saved
+		srv.Close()
+	})
+	return f
+}
+
+func (f *fakeDynamoDB) key(table string, item map[string]interface{}) string {
+	values := []interface{}{}
+	for _, name := range strings.Fields(f.keys[table]) {
+		values = append(values, item[name])
+	}
+	k, _ := json.Marshal(values)
+	return string(k)
+}
+
+func (f *fakeDynamoDB) table(name string) map[string]map[string]interface{} {
+	if f.tables[name] == nil {
+		f.tables[name] = map[string]map[string]interface{}{}
+	}
+	return f.tables[name]
+}
+
+func (f *fakeDynamoDB) put(table string, item map[string]interface{}) map[string]interface{} {
+	k := f.key(table, item)
+	old := f.table(table)[k]
+	f.table(table)[k] = item
+	return old
+}
+
+func (f *fakeDynamoDB) delete(table string, key map[string]interface{}) map[string]interface{} {
+	k := f.key(table, key)
+	old := f.table(table)[k]
+	delete(f.table(table), k)
+	return old
+}
+
+// updateSet adds the values of the string set to the attribute or deletes them from it,
+// the attribute is removed once the set is empty as dynamodb does
+func (f *fakeDynamoDB) updateSet(table string, key map[string]interface{}, expr string, values map[string]interface{}) bool {
+	m := patternSetUpdate.FindStringSubmatch(expr)
+	if m == nil {
+		return false
+	}
+	op, attr, value := m[1], m[2], values[m[3]].(map[string]interface{})["SS"].([]interface{})
+
+	k := f.key(table, key)
+	item := f.table(table)[k]
+	if item == nil {
+		item = map[string]interface{}{}
+		for name, v := range key {
+			item[name] = v
+		}
+		f.table(table)[k] = item
+	}
+	set := map[interface{}]bool{}
+	if old, ok := item[attr].(map[string]interface{}); ok {
+		for _, v := range old["SS"].([]interface{}) {
+			set[v] = true
+		}
+	}
+	for _, v := range value {
+		set[v] = op == "add"
+	}
+	members := []interface{}{}
+	for v, in := range set {
+		if in {
+			members = append(members, v)
+		}
+	}
+	if len(members) == 0 {
+		delete(item, attr)
+	} else {
+		item[attr] = map[string]interface{}{"SS": members}
+	}
+	return true
+}
+
+// check evaluates the condition of the supported forms, joined by "and", on the item of the key, ok is false
+// if it isn't supported
+func (f *fakeDynamoDB) check(table string, key map[string]interface{}, cond string, values map[string]interface{}) (met, ok bool) {
+	if cond == "" {
+		return true, true
+	}
+	item := f.table(table)[f.key(table, key)]
+	met = true
+	for _, clause := range strings.Split(cond, " and ") {
+		m := patternCondition.FindStringSubmatch(clause)
+		if m == nil {
+			return false, false
+		}
+		switch m[1] {
+		case "attribute_exists":
+			met = met && item[m[2]] != nil
+		case "attribute_not_exists":
+			met = met && item[m[2]] == nil
+		default:
+			met = met && item != nil && reflect.DeepEqual(item[m[3]], values[m[4]])
+		}
+	}
+	return met, true
+}
+
+// set assigns the values to the attributes of the item, only "set a = :a, ..." is supported
+func (f *fakeDynamoDB) set(table string, key map[string]interface{}, expr string, names map[string]string, values map[string]interface{}) bool {
+	if !strings.HasPrefix(expr, "set ") {
+		return false
+	}
+	k := f.key(table, key)
+	item := f.table(table)[k]
+	if item == nil {
+		item = map[string]interface{}{}
+		for name, v := range key {
+			item[name] = v
+		}
+		f.table(table)[k] = item
+	}
+	for _, assignment := range strings.Split(strings.TrimPrefix(expr, "set "), ", ") {
+		m := patternAssignment.FindStringSubmatch(assignment)
+		if m == nil {
+			return false
+		}
+		name := m[1]
+		if n, ok := names[name]; ok {
+			name = n
+		}
+		item[name] = values[m[2]]
+	}
+	return true
+}
+
+type fakeTransactWrite struct {
+	TableName                 string
+	Item                      map[string]interface{}
+	Key                       map[string]interface{}
+	ConditionExpression       string
+	UpdateExpression          string
+	ExpressionAttributeValues map[string]interface{}
+}
+
+type fakeDynamoDBInput struct {
+	TableName                 string
+	Item                      map[string]interface{}
+	Key                       map[string]interface{}
+	ReturnValues              string
+	ConditionExpression       string
+	UpdateExpression          string
+	KeyConditionExpression    string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues map[string]interface{}
+	Limit                     int
+	TransactItems             []struct {
+		Put, Delete, Update *fakeTransactWrite
+	}
+	RequestItems map[string][]struct {
+		PutRequest    *struct{ Item map[string]interface{} }
+		DeleteRequest *struct{ Key map[string]interface{} }
+	}
+}
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	in := fakeDynamoDBInput{}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		f.fail(w, err.Error())
+		return
+	}
+	key := in.Key
+	if key == nil {
+		key = in.Item
+	}
+	if met, ok := f.check(in.TableName, key, in.ConditionExpression, in.ExpressionAttributeValues); !ok {
+		f.fail(w, "unsupported condition "+in.ConditionExpression)
+		return
+	} else if !met {
+		f.failWith(w, "ConditionalCheckFailedException", "the conditional request failed")
+		return
+	}
+	out := map[string]interface{}{}
+	switch op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810."); op {
+	case "PutItem":
+		if old := f.put(in.TableName, in.Item); old != nil && in.ReturnValues == "ALL_OLD" {
+			out["Attributes"] = old
+		}
+	case "GetItem":
+		if item := f.table(in.TableName)[f.key(in.TableName, in.Key)]; item != nil {
+			out["Item"] = item
+		}
+	case "DeleteItem":
+		if old := f.delete(in.TableName, in.Key); old != nil && in.ReturnValues == "ALL_OLD" {
+			out["Attributes"] = old
+		}
+	case "UpdateItem":
+		if !f.set(in.TableName, in.Key, in.UpdateExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues) {
+			f.fail(w, "unsupported update "+in.UpdateExpression)
+			return
+		}
+	case "Scan":
+		items := []interface{}{}
+		for _, item := range f.table(in.TableName) {
+			if in.Limit > 0 && len(items) == in.Limit {
+				break
+			}
+			items = append(items, item)
+		}
+		out["Items"], out["Count"], out["ScannedCount"] = items, len(items), len(items)
+	case "Query":
+		// only "a = :a" on the partition key of the table or an index projecting all the attributes
+		m := patternCondition.FindStringSubmatch(in.KeyConditionExpression)
+		if m == nil || m[3] == "" {
+			f.fail(w, "unsupported key condition "+in.KeyConditionExpression)
+			return
+		}
+		items := []interface{}{}
+		for _, item := range f.table(in.TableName) {
+			if reflect.DeepEqual(item[m[3]], in.ExpressionAttributeValues[m[4]]) {
+				items = append(items, item)
+			}
+		}
+		out["Items"], out["Count"], out["ScannedCount"] = items, len(items), len(items)
+	case "TransactWriteItems":
+		if len(in.TransactItems) > ddbTransactionSize {
+			f.fail(w, "too many items in the transaction")
+			return
+		}
+		if f.beforeTransaction != nil {
+			f.beforeTransaction()
+		}
+		if f.failTransactionsFrom > 0 && len(f.transactions)+1 >= f.failTransactionsFrom {
+			f.fail(w, "injected transaction failure")
+			return
+		}
+		// all or nothing, the conditions are checked ahead of any write
+		for _, item := range in.TransactItems {
+			write := item.Put
+			if write == nil {
+				write = item.Delete
+			}
+			if write == nil {
+				continue
+			}
+			key := write.Key
+			if key == nil {
+				key = write.Item
+			}
+			met, ok := f.check(write.TableName, key, write.ConditionExpression, write.ExpressionAttributeValues)
+			if !ok {
+				f.fail(w, "unsupported condition "+write.ConditionExpression)
+				return
+			}
+			if !met {
+				f.failWith(w, "TransactionCanceledException", "transaction cancelled, ConditionalCheckFailed")
+				return
+			}
+		}
+		f.transactions = append(f.transactions, len(in.TransactItems))
+		for _, item := range in.TransactItems {
+			switch {
+			case item.Put != nil:
+				f.put(item.Put.TableName, item.Put.Item)
+			case item.Delete != nil:
+				f.delete(item.Delete.TableName, item.Delete.Key)
+			case item.Update == nil || !f.updateSet(item.Update.TableName, item.Update.Key, item.Update.UpdateExpression, item.Update.ExpressionAttributeValues):
+				f.fail(w, "unsupported transaction item")
+				return
+			}
+		}
+	case "BatchWriteItem":
+		for table, requests := range in.RequestItems {
+			if len(requests) > ddbBatchSize {
+				f.fail(w, "too many items in the batch")
+				return
+			}
+			for _, req := range requests {
+				if req.PutRequest != nil {
+					f.put(table, req.PutRequest.Item)
+				} else {
+					f.delete(table, req.DeleteRequest.Key)
+				}
+			}
+		}
+		out["UnprocessedItems"] = map[string]interface{}{}
+	default:
+		f.fail(w, "unsupported operation "+op)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (f *fakeDynamoDB) fail(w http.ResponseWriter, message string) {
+	f.failWith(w, "ValidationException", message)
+}
+
+func (f *fakeDynamoDB) failWith(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  "com.amazonaws.dynamodb.v20120810#" + code,
+		"message": message,
+	})
+}
+
+// tagGroups gets the chat IDs indexed under the tag, sorted
+func (f *fakeDynamoDB) tagGroups(tag string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	groups := []string{}
+	item := f.table("tags")[f.key("tags", map[string]interface{}{"tag": map[string]interface{}{"S": tag}})]
+	if set, ok := item["groups"].(map[string]interface{}); ok {
+		for _, v := range set["SS"].([]interface{}) {
+			groups = append(groups, v.(string))
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func TestDiffTags(t *testing.T) {
+	cases := []struct {
+		old, new, add, del []string
+	}{
+		{nil, []string{"go", "rust"}, []string{"go", "rust"}, nil},
+		{[]string{"go", "rust"}, []string{"rust", "zig"}, []string{"zig"}, []string{"go"}},
+		{[]string{"go", "rust"}, nil, nil, []string{"go", "rust"}},
+		{[]string{"go", "go", "rust"}, []string{"rust", "zig", "zig"}, []string{"zig"}, []string{"go"}},
+		{[]string{"go"}, []string{"go"}, nil, nil},
+	}
+	for _, c := range cases {
+		add, del := diffTags(c.old, c.new)
+		if !reflect.DeepEqual(add, c.add) || !reflect.DeepEqual(del, c.del) {
+			t.Errorf("diffTags(%v, %v) = %v, %v, want %v, %v", c.old, c.new, add, del, c.add, c.del)
+		}
+	}
+}
+
+func TestTagIndex(t *testing.T) {
+	index := tagIndex([]GroupRecord{
+		{ChatID: -1, Tags: []string{"go", "rust", "go"}},
+		{ChatID: -2, Tags: []string{"go"}},
+		{ChatID: -3},
+	})
+	want := map[string][]string{"go": {"-1", "-2"}, "rust": {"-1"}}
+	if !reflect.DeepEqual(index, want) {
+		t.Errorf("got %v, want %v", index, want)
+	}
+}
+
+func TestDdbWriteGroupMovesTags(t *testing.T) {
+	f := newFakeDynamoDB(t)
+	ctx := context.Background()
+
+	for _, g := range []GroupRecord{
+		{ChatID: -1, Tags: []string{"go", "rust"}},
+		{ChatID: -2, Tags: []string{"go"}},
+		{ChatID: -1, Tags: []string{"rust", "zig"}},
+	} {
+		if _, err := ddbWriteGroup(ctx, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for tag, want := range map[string][]string{"go": {"-2"}, "rust": {"-1"}, "zig": {"-1"}} {
+		if got := f.tagGroups(tag); !reflect.DeepEqual(got, want) {
+			t.Errorf("tag %s: got %v, want %v", tag, got, want)
+		}
+	}
+
+	if err := ddbDeleteGroup(ctx, -1); err != nil {
+		t.Fatal(err)
+	}
+	for tag, want := range map[string][]string{"go": {"-2"}, "rust": {}, "zig": {}} {
+		if got := f.tagGroups(tag); !reflect.DeepEqual(got, want) {
+			t.Errorf("after delete, tag %s: got %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestDdbWriteGroupManyTags(t *testing.T) {
+	f := newFakeDynamoDB(t)
+
+	tags := []string{}
+	for i := 0; i < 30; i++ {
+		tags = append(tags, "tag"+strconv.Itoa(i))
+	}
+	if _, err := ddbWriteGroup(context.Background(), GroupRecord{ChatID: -1, Tags: tags}); err != nil {
+		t.Fatal(err)
+	}
+	// the group is put along with the first 24 tags
+	if !reflect.DeepEqual(f.transactions, []int{25, 6}) {
+		t.Errorf("got transactions %v, want [25 6]", f.transactions)
+	}
+	for _, tag := range tags {
+		if got := f.tagGroups(tag); !reflect.DeepEqual(got, []string{"-1"}) {
+			t.Errorf("tag %s: got %v", tag, got)
+		}
+	}
+}
+
+func TestDdbWriteGroupFailedLeavesTags(t *testing.T) {
+	f := newFakeDynamoDB(t)
+	ctx := context.Background()
+
+	if _, err := ddbWriteGroup(ctx, GroupRecord{ChatID: -1, Tags: []string{"go"}}); err != nil {
+		t.Fatal(err)
+	}
+	f.failTransactionsFrom = len(f.transactions) + 1
+	if _, err := ddbWriteGroup(ctx, GroupRecord{ChatID: -1, Tags: []string{"rust"}}); err == nil {
+		t.Fatal("expect the failed write to fail")
+	}
+	if g, _, _ := ddbGetGroup(ctx, -1); !reflect.DeepEqual(g.Tags, []string{"go"}) {
+		t.Fatalf("got tags %v, want the group left as it was", g.Tags)
+	}
+
+	// the diff of the next write is still made against the tags indexed
+	f.failTransactionsFrom = 0
+	if _, err := ddbWriteGroup(ctx, GroupRecord{ChatID: -1, Tags: []string{"rust"}}); err != nil {
+		t.Fatal(err)
+	}
+	for tag, want := range map[string][]string{"go": {}, "rust": {"-1"}} {
+		if got := f.tagGroups(tag); !reflect.DeepEqual(got, want) {
+			t.Errorf("tag %s: got %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestDdbWriteGroupRacingWrite(t *testing.T) {
+	f := newFakeDynamoDB(t)
+	ctx := context.Background()
+
+	if _, err := ddbWriteGroup(ctx, GroupRecord{ChatID: -1, Tags: []string{"go"}}); err != nil {
+		t.Fatal(err)
+	}
+	// another write moves the group from go to zig between reading the group and writing it
+	f.beforeTransaction = func() {
+		f.beforeTransaction = nil
+		key := map[string]interface{}{"chat_id": map[string]interface{}{"N": "-1"}}
+		f.put("groups", map[string]interface{}{"chat_id": key["chat_id"], "tags": map[string]interface{}{"SS": []interface{}{"zig"}}})
+		group := map[string]interface{}{":group": map[string]interface{}{"SS": []interface{}{"-1"}}}
+		f.updateSet("tags", map[string]interface{}{"tag": map[string]interface{}{"S": "go"}}, "delete groups :group", group)
+		f.updateSet("tags", map[string]interface{}{"tag": map[string]interface{}{"S": "zig"}}, "add groups :group", group)
+	}
+
+	old, err := ddbWriteGroup(ctx, GroupRecord{ChatID: -1, Tags: []string{"rust"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old == nil || !reflect.DeepEqual(old.Tags, []string{"zig"}) {
+		t.Errorf("got old %+v, want the group of the racing write", old)
+	}
+	for tag, want := range map[string][]string{"go": {}, "zig": {}, "rust": {"-1"}} {
+		if got := f.tagGroups(tag); !reflect.DeepEqual(got, want) {
+			t.Errorf("tag %s: got %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestRepairTags(t *testing.T) {
+	f := newFakeDynamoDB(t)
+	ctx := context.Background()
+
+	for _, g := range []GroupRecord{
+		{ChatID: -1, Tags: []string{"go", "rust"}},
+		{ChatID: -2, Tags: []string{"go"}},
+	} {
+		if _, err := ddbWriteGroup(ctx, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// stale entries left by the broken diff
+	f.put("tags", map[string]interface{}{"tag": map[string]interface{}{"S": "rust"}, "groups": map[string]interface{}{"SS": []interface{}{"-1", "-2"}}})
+	f.put("tags", map[string]interface{}{"tag": map[string]interface{}{"S": "java"}, "groups": map[string]interface{}{"SS": []interface{}{"-2"}}})
+
+	if err := repairTags(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for tag, want := range map[string][]string{"go": {"-1", "-2"}, "rust": {"-1"}, "java": {}} {
+		if got := f.tagGroups(tag); !reflect.DeepEqual(got, want) {
+			t.Errorf("tag %s: got %v, want %v", tag, got, want)
+		}
+	}
+	if _, ok := f.tables["tags"][f.key("tags", map[string]interface{}{"tag": map[string]interface{}{"S": "java"}})]; ok {
+		t.Error("stale tag java not deleted")
+	}
+}
+
+func TestGroupUpdateExpression(t *testing.T) {
+	expr, names, values, err := groupUpdateExpression(map[string]interface{}{
+		"daily_messages": 42,
+		"activity":       ActivityHigh,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fields are in order so the expression is stable
+	if expr != "set #f0 = :v0, #f1 = :v1" {
+		t.Errorf("got expression %q", expr)
+	}
+	if names["#f0"] != "activity" || names["#f1"] != "daily_messages" {
+		t.Errorf("got names %v", names)
+	}
+	if v, ok := values[":v0"].(*types.AttributeValueMemberS); !ok || v.Value != ActivityHigh {
+		t.Errorf("got :v0 %#v", values[":v0"])
+	}
+	if v, ok := values[":v1"].(*types.AttributeValueMemberN); !ok || v.Value != "42" {
+		t.Errorf("got :v1 %#v", values[":v1"])
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// how many member count snapshots the detail view shows
+const detailHistoryDays = 7
+
+// groupSearchable tells whether users are allowed to see the group
+func groupSearchable(g GroupRecord) bool {
+	return g.Status == "" || g.Status == GroupStatusApproved
+}
+
+// resultKeyboard has a numbered button for each listed group to open its detail view,
+// the clicks are tracked if the groups are the results of the logged search
+func resultKeyboard(groups []GroupRecord, offset int, logID string) *tgbotapi.InlineKeyboardMarkup {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	row := []tgbotapi.InlineKeyboardButton{}
+	for i, g := range groups {
+		args := []string{strconv.FormatInt(g.ChatID, 10)}
+		if logID != "" {
+			args = append(args, logID)
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(offset+i+1), newCallbackData(CallbackGroup, args...)))
+		if len(row) == 5 {
+			rows = append(rows, row)
+			row = []tgbotapi.InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &keyboard
+}
+
+func formatTime(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+	return time.Unix(unix, 0).Format("2006/01/02 15:04")
+}
+
+// formatGroupDetail renders everything we know about the group in HTML
+func formatGroupDetail(ctx context.Context, g GroupRecord, history []SnapshotRecord) string {
+	icon := "👥"
+	if g.Type == "channel" {
+		icon = "📢"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s <b>%s</b>\n%s\n\n", icon, html.EscapeString(g.Title), getGroupURL(g))
+	fmt.Fprintf(&b, "%s: %s", getLocalizedText(ctx, DetailMembers), strings.TrimSpace(formatMemberCount(g.MemberCount)))
+	if g.MemberGrowth != 0 {
+		fmt.Fprintf(&b, " (%+d)", g.MemberGrowth)
+	}
+	b.WriteString("\n")
+	if g.Category != "" {
+		category := g.Category
+		if c, _ := findCategory(categoryTree, g.Category, nil); c != nil {
+			category = getLocalizedCategory(ctx, c)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", getLocalizedText(ctx, DetailCategory), html.EscapeString(category))
+	}
+	if len(g.Tags) > 0 {
+		fmt.Fprintf(&b, "%s: %s\n", getLocalizedText(ctx, DetailTags), html.EscapeString(strings.Join(g.Tags, " ")))
+	}
+	if g.Activity != "" {
+		fmt.Fprintf(&b, "%s: %s\n", getLocalizedText(ctx, DetailActivity), g.Activity)
+	}
+	if g.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", html.EscapeString(g.Description))
+	}
+
+	if len(history) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", getLocalizedText(ctx, DetailHistory))
+		for _, s := range history {
+			day, err := time.Parse(snapshotDayFormat, s.Day)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(&b, "%s  %s\n", day.Format("01/02"), strings.TrimSpace(formatMemberCount(s.MemberCount)))
+		}
+	}
+
+	fmt.Fprintf(&b, "\n%s: %s\n%s: %s", getLocalizedText(ctx, DetailIndexedAt), formatTime(g.CreatedAt), getLocalizedText(ctx, DetailRefreshedAt), formatTime(g.UpdatedAt))
+	return b.String()
+}
+
+func detailKeyboard(ctx context.Context, g GroupRecord) tgbotapi.InlineKeyboardMarkup {
+	id := strconv.FormatInt(g.ChatID, 10)
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL(getLocalizedText(ctx, DetailJoin), getGroupURL(g)),
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, DetailReport), newCallbackData(CallbackReport, id)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, DetailSimilar), newCallbackData(CallbackSimilar, id)),
+		),
+	)
+}
+
+// sendGroupDetail sends the detail view of the group
+func sendGroupDetail(ctx context.Context, chatID int64, g GroupRecord) {
+	since := time.Now().UTC().AddDate(0, 0, -detailHistoryDays).Format(snapshotDayFormat)
+	history := ddbGetSnapshots(ctx, g.ChatID, since)
+
+	msg := tgbotapi.NewMessage(chatID, formatGroupDetail(ctx, g, history))
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = detailKeyboard(ctx, g)
+	if _, err := botSend(ctx, msg); err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", g.ChatID).Msg("send group detail")
+	}
+}
+
+// groupCommandHandler handles /group <username or link>
+func groupCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	defer clearState(s.ChatID)
+
+	if update.Message == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+
+	groupUsername := getCheckGroupUsername(strings.TrimSpace(update.Message.CommandArguments()))
+	if groupUsername == "" {
+		sendText(ctx, chatID, getLocalizedText(ctx, GroupUsage))
+		return
+	}
+
+	g, found := opensearchFindGroupByUsername(ctx, groupUsername)
+	if !found || !groupSearchable(g) {
+		sendText(ctx, chatID, getLocalizedText(ctx, GroupNotIndexed))
+		return
+	}
+	sendGroupDetail(ctx, chatID, g)
+}
+
+// groupCallbackHandler opens the detail view of a listed group, args are the group chat ID and the search log ID if tracked
+func groupCallbackHandler(ctx context.Context, update *tgbotapi.Update, args []string) {
+	defer answerCallback(ctx, update, "")
+
+	query := update.CallbackQuery
+	if len(args) < 1 || query.Message == nil {
+		return
+	}
+	groupID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return
+	}
+
+	if len(args) > 1 {
+		logSearchClick(ctx, args[1], groupID)
+	}
+
+	g, found := getGroup(ctx, groupID)
+	if !found || !groupSearchable(g) {
+		sendText(ctx, query.Message.Chat.ID, getLocalizedText(ctx, GroupNotIndexed))
+		return
+	}
+	sendGroupDetail(ctx, query.Message.Chat.ID, g)
+}
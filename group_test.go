@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestResultKeyboard(t *testing.T) {
+	if resultKeyboard(nil, 0, "") != nil {
+		t.Error("expect no keyboard without groups")
+	}
+
+	groups := make([]GroupRecord, 7)
+	for i := range groups {
+		groups[i].ChatID = int64(-100 - i)
+	}
+	keyboard := resultKeyboard(groups, 10, "")
+	if len(keyboard.InlineKeyboard) != 2 || len(keyboard.InlineKeyboard[0]) != 5 {
+		t.Fatalf("expect rows of 5 buttons, got %+v", keyboard.InlineKeyboard)
+	}
+	if b := keyboard.InlineKeyboard[1][1]; b.Text != "17" || *b.CallbackData != "grp:-106" {
+		t.Errorf("unexpected button %s %s", b.Text, *b.CallbackData)
+	}
+
+	keyboard = resultKeyboard(groups[:1], 0, "20211120.abc")
+	if b := keyboard.InlineKeyboard[0][0]; *b.CallbackData != "grp:-100:20211120.abc" {
+		t.Errorf("expect the search log ID tracked, got %s", *b.CallbackData)
+	}
+}
+
+func TestFormatGroupDetail(t *testing.T) {
+	g := GroupRecord{
+		Username:     "gophers",
+		Title:        "Go <Gophers>",
+		Type:         "supergroup",
+		Description:  "all about Go",
+		MemberCount:  1500,
+		MemberGrowth: 20,
+		Category:     TopicProgramming,
+		Tags:         []string{"go", "golang"},
+	}
+	history := []SnapshotRecord{{Day: "20211119", MemberCount: 1480}, {Day: "20211120", MemberCount: 1500}}
+
+	detail := formatGroupDetail(context.Background(), g, history)
+	for _, want := range []string{"Go &lt;Gophers&gt;", "https://t.me/gophers", "(+20)", "go golang", "11/19  1.5k", TopicKeyboardTexts[TopicProgramming]["zh"]} {
+		if !strings.Contains(detail, want) {
+			t.Errorf("detail doesn't contain %q:\n%s", want, detail)
+		}
+	}
+}
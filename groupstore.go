@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// The groups table in dynamodb is the system of record of the groups, the opensearch index is derived from it.
+// Every change is first recorded in the outbox, then made to the groups table and synced to the index right
+// away. The changes failed to sync are left in the outbox and retried by the outbox flusher.
+
+const outboxGrace = 30 * time.Second // the flusher leaves the fresh changes to the inline sync
+
+var outboxFlushInterval = time.Minute
+
+// the index the groups are synced to, swapped in tests
+var (
+	indexGroup   = opensearchWriteGroup
+	unindexGroup = opensearchDeleteGroup
+)
+
+var (
+	errGroupsTableEmpty = errors.New("the groups table is empty, run -import-groups first")
+	errGroupNotStored   = errors.New("the group isn't stored")
+	errTagIndex         = errors.New("the group is stored but the tags table isn't updated, run -repair-tags")
+)
+
+// getGroup gets the group from the groups table
+func getGroup(ctx context.Context, chatID int64) (GroupRecord, bool) {
+	g, found, err := ddbGetGroup(ctx, chatID)
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("get group")
+		return GroupRecord{}, false
+	}
+	return g, found
+}
+
+// writeGroup stores the group and syncs it to the index, the subscribers are alerted once it's approved
+func writeGroup(ctx context.Context, r GroupRecord) {
+	var old *GroupRecord
+	stored := changeGroup(ctx, r.ChatID, func() (err error) {
+		old, err = ddbWriteGroup(ctx, r)
+		return err
+	})
+	// only when it turns searchable, not on every refresh of an approved group
+	if stored && r.Status == GroupStatusApproved && (old == nil || !groupSearchable(*old)) {
+		queueSubscriptionAlerts(ctx, r)
+	}
+}
+
+// updateGroup updates some fields of a stored group and syncs it to the index
+func updateGroup(ctx context.Context, chatID int64, fields map[string]interface{}) {
+	changeGroup(ctx, chatID, func() error { return ddbUpdateGroup(ctx, chatID, fields) })
+}
+
+// deleteGroup deletes the group and takes it out of the index
+func deleteGroup(ctx context.Context, chatID int64) {
+	changeGroup(ctx, chatID, func() error { return ddbDeleteGroup(ctx, chatID) })
+}
+
+// changeGroup records the change in the outbox ahead of making it, so a change can't be made without being
+// synced eventually. A change that isn't made only costs an extra sync of what's stored. It tells whether the
+// change is made, whether or not it's synced yet.
+func changeGroup(ctx context.Context, chatID int64, change func() error) bool {
+	version, err := ddbWriteOutbox(ctx, chatID)
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("write outbox")
+		return false
+	}
+	err = change()
+	if errors.Is(err, errGroupNotStored) {
+		// nothing changed, the index is left as it is rather than synced to the missing group
+		logger(ctx).Warn().Int64("group_id", chatID).Msg("update a group not stored")
+		ddbDeleteOutbox(ctx, OutboxRecord{ChatID: chatID, Version: version})
+		return false
+	}
+	if errors.Is(err, errTagIndex) {
+		// the change is made, only the tags table is left behind
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("update tag index")
+	} else if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("store group")
+		return false
+	}
+	if err := syncGroup(ctx, chatID); err != nil {
+		// left in the outbox for the flusher
+		logger(ctx).Warn().Err(err).Int64("group_id", chatID).Msg("sync group")
+		return true
+	}
+	ddbDeleteOutbox(ctx, OutboxRecord{ChatID: chatID, Version: version})
+	return true
+}
+
+// syncGroup makes the index agree with the groups table on the group
+func syncGroup(ctx context.Context, chatID int64) error {
+	g, found, err := ddbGetGroup(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return unindexGroup(ctx, chatID)
+	}
+	return indexGroup(ctx, g)
+}
+
+// flushOutbox syncs the changes left in the outbox
+func flushOutbox(ctx context.Context) {
+	records, err := ddbListOutbox(ctx)
+	if err != nil {
+		logger(ctx).Error().Err(err).Msg("list outbox")
+	}
+	synced := 0
+	for _, r := range records {
+		if time.Since(time.Unix(0, r.Version)) < outboxGrace {
+			continue
+		}
+		if err := syncGroup(ctx, r.ChatID); err != nil {
+			logger(ctx).Warn().Err(err).Int64("group_id", r.ChatID).Msg("sync group")
+			continue
+		}
+		ddbDeleteOutbox(ctx, r)
+		synced++
+	}
+	if synced > 0 {
+		logger(ctx).Info().Int("synced", synced).Msg("outbox flushed")
+	}
+}
+
+// startOutboxFlusher flushes the outbox periodically until ctx is done
+func startOutboxFlusher(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(outboxFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flushOutbox(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// checkGroupsTable refuses to run on an empty groups table while the index has groups, the table hasn't been
+// imported yet then, and every group would be taken for a new one and re-submitted for review
+func checkGroupsTable(ctx context.Context) error {
+	empty, err := ddbGroupsTableEmpty(ctx)
+	if err != nil || !empty {
+		return err
+	}
+	indexed, err := opensearchCountGroups(ctx)
+	if err != nil {
+		return err
+	}
+	if indexed > 0 {
+		return errGroupsTableEmpty
+	}
+	return nil
+}
+
+// reindexGroups rebuilds the index from the groups table, the indexed groups which aren't stored are deleted
+func reindexGroups(ctx context.Context) error {
+	stored := map[int64]bool{}
+	indexed, failed := 0, 0
+	err := ddbScanGroups(ctx, func(g GroupRecord) {
+		stored[g.ChatID] = true
+		if err := opensearchWriteGroup(ctx, g); err != nil {
+			logger(ctx).Error().Err(err).Int64("group_id", g.ChatID).Msg("reindex group")
+			failed++
+			return
+		}
+		indexed++
+	})
+	if err != nil {
+		return err
+	}
+	// an empty table more likely hasn't been imported than has no groups, don't wipe the index
+	if len(stored) == 0 {
+		return errGroupsTableEmpty
+	}
+
+	orphans := []int64{}
+	err = opensearchScanGroups(ctx, func(g GroupRecord) {
+		if !stored[g.ChatID] {
+			orphans = append(orphans, g.ChatID)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, chatID := range orphans {
+		if err := opensearchDeleteGroup(ctx, chatID); err != nil {
+			logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("delete orphan group")
+			failed++
+		}
+	}
+	logger(ctx).Info().Int("indexed", indexed).Int("deleted", len(orphans)).Int("failed", failed).Msg("reindex done")
+	return nil
+}
+
+// importGroups copies the indexed groups missing from the groups table into it, to set up the table from
+// the index which used to be the only copy of the groups
+func importGroups(ctx context.Context) error {
+	imported, failed := 0, 0
+	err := opensearchScanGroups(ctx, func(g GroupRecord) {
+		_, found, err := ddbGetGroup(ctx, g.ChatID)
+		if err == nil && !found {
+			if _, err = ddbWriteGroup(ctx, g); err == nil {
+				imported++
+			}
+		}
+		if err != nil {
+			logger(ctx).Error().Err(err).Int64("group_id", g.ChatID).Msg("import group")
+			failed++
+		}
+	})
+	logger(ctx).Info().Int("imported", imported).Int("failed", failed).Msg("import done")
+	return err
+}
+
+// tagIndex lists the chat IDs of the groups of each tag
+func tagIndex(groups []GroupRecord) map[string][]string {
+	index := map[string][]string{}
+	for _, g := range groups {
+		group := strconv.FormatInt(g.ChatID, 10)
+		for _, tag := range g.Tags {
+			if n := len(index[tag]); n > 0 && index[tag][n-1] == group {
+				continue
+			}
+			index[tag] = append(index[tag], group)
+		}
+	}
+	return index
+}
+
+// repairTags rebuilds the tags' indexes from the groups table, the tags no group has any more are deleted
+func repairTags(ctx context.Context) error {
+	groups := []GroupRecord{}
+	if err := ddbScanGroups(ctx, func(g GroupRecord) { groups = append(groups, g) }); err != nil {
+		return err
+	}
+	existing, err := ddbScanTags(ctx)
+	if err != nil {
+		return err
+	}
+
+	index := tagIndex(groups)
+	requests := []types.WriteRequest{}
+	for tag, chatIDs := range index {
+		item, err := attributevalue.MarshalMap(TagRecord{Tag: tag, Groups: chatIDs})
+		if err != nil {
+			return err
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+	deleted := 0
+	for _, r := range existing {
+		if _, ok := index[r.Tag]; ok {
+			continue
+		}
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+			"tag": &types.AttributeValueMemberS{Value: r.Tag},
+		}}})
+		deleted++
+	}
+	if err := ddbBatchWrite(ctx, "tags", requests); err != nil {
+		return err
+	}
+	logger(ctx).Info().Int("groups", len(groups)).Int("tags", len(index)).Int("deleted", deleted).Msg("tags repaired")
+	return nil
+}
+
+func init() {
+	if v, err := strconv.Atoi(os.Getenv("OUTBOX_FLUSH_SECONDS")); err == nil && v > 0 {
+		outboxFlushInterval = time.Duration(v) * time.Second
+	}
+}
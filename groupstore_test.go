@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// stubIndex stands in for the search index until the test ends, recording the synced groups
+type stubIndex struct {
+	err       error // returned by every call if set
+	indexed   []int64
+	unindexed []int64
+}
+
+func newStubIndex(t *testing.T) *stubIndex {
+	s := &stubIndex{}
+	savedIndex, savedUnindex := indexGroup, unindexGroup
+	indexGroup = func(ctx context.Context, g GroupRecord) error {
+		if s.err == nil {
+			s.indexed = append(s.indexed, g.ChatID)
+		}
+		return s.err
+	}
+	unindexGroup = func(ctx context.Context, chatID int64) error {
+		if s.err == nil {
+			s.unindexed = append(s.unindexed, chatID)
+		}
+		return s.err
+	}
+	t.Cleanup(func() { indexGroup, unindexGroup = savedIndex, savedUnindex })
+	return s
+}
+
+// putOutbox writes the outbox record as of the time given
+func putOutbox(t *testing.T, chatID int64, at time.Time) {
+	item, _ := attributevalue.MarshalMap(OutboxRecord{ChatID: chatID, Version: at.UnixNano()})
+	_, err := dynsvc.PutItem(context.Background(), &dynamodb.PutItemInput{TableName: aws.String("group_outbox"), Item: item})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func outboxChatIDs(t *testing.T) map[int64]int64 {
+	records, err := ddbListOutbox(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := map[int64]int64{}
+	for _, r := range records {
+		versions[r.ChatID] = r.Version
+	}
+	return versions
+}
+
+func TestChangeGroupKeepsOutboxOnFailedSync(t *testing.T) {
+	newFakeDynamoDB(t)
+	index := newStubIndex(t)
+	ctx := context.Background()
+
+	index.err = errors.New("opensearch down")
+	writeGroup(ctx, GroupRecord{ChatID: -1, Title: "gophers", Status: GroupStatusPending})
+	if _, found, _ := ddbGetGroup(ctx, -1); !found {
+		t.Fatal("the group isn't stored")
+	}
+	if _, ok := outboxChatIDs(t)[-1]; !ok {
+		t.Fatal("the change failed to sync is gone from the outbox")
+	}
+
+	index.err = nil
+	writeGroup(ctx, GroupRecord{ChatID: -1, Title: "gophers", Status: GroupStatusPending})
+	if len(outboxChatIDs(t)) != 0 || len(index.indexed) != 1 {
+		t.Errorf("the synced change is left in the outbox: %v, indexed %v", outboxChatIDs(t), index.indexed)
+	}
+}
+
+func TestDdbDeleteOutboxKeepsNewerVersion(t *testing.T) {
+	newFakeDynamoDB(t)
+	ctx := context.Background()
+
+	older, err := ddbWriteOutbox(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	newer, _ := ddbWriteOutbox(ctx, -1)
+
+	// the sync of the older change doesn't cover the newer one
+	ddbDeleteOutbox(ctx, OutboxRecord{ChatID: -1, Version: older})
+	if v := outboxChatIDs(t)[-1]; v != newer {
+		t.Fatalf("got version %d in the outbox, want the newer %d", v, newer)
+	}
+	ddbDeleteOutbox(ctx, OutboxRecord{ChatID: -1, Version: newer})
+	if len(outboxChatIDs(t)) != 0 {
+		t.Errorf("the synced change is left in the outbox: %v", outboxChatIDs(t))
+	}
+}
+
+func TestFlushOutboxGrace(t *testing.T) {
+	newFakeDynamoDB(t)
+	index := newStubIndex(t)
+	ctx := context.Background()
+
+	if _, err := ddbWriteGroup(ctx, GroupRecord{ChatID: -1, Title: "fresh"}); err != nil {
+		t.Fatal(err)
+	}
+	putOutbox(t, -1, time.Now())                     // being synced inline
+	putOutbox(t, -2, time.Now().Add(-2*outboxGrace)) // left behind, and deleted since
+	putOutbox(t, -3, time.Now().Add(-2*outboxGrace)) // left behind, failing again
+	if _, err := ddbWriteGroup(ctx, GroupRecord{ChatID: -3}); err != nil {
+		t.Fatal(err)
+	}
+	failing := indexGroup
+	indexGroup = func(ctx context.Context, g GroupRecord) error {
+		if g.ChatID == -3 {
+			return errors.New("rejected")
+		}
+		return failing(ctx, g)
+	}
+
+	flushOutbox(ctx)
+	if len(index.indexed) != 0 || len(index.unindexed) != 1 || index.unindexed[0] != -2 {
+		t.Errorf("got indexed %v, unindexed %v, want only -2 unindexed", index.indexed, index.unindexed)
+	}
+	outbox := outboxChatIDs(t)
+	if _, ok := outbox[-1]; !ok {
+		t.Error("the fresh change is flushed within the grace")
+	}
+	if _, ok := outbox[-2]; ok {
+		t.Error("the synced change is left in the outbox")
+	}
+	if _, ok := outbox[-3]; !ok {
+		t.Error("the change failed to sync is gone from the outbox")
+	}
+}
+
+func TestUpdateGroupNotStored(t *testing.T) {
+	newFakeDynamoDB(t)
+	index := newStubIndex(t)
+	ctx := context.Background()
+
+	// e.g. the activity of a group deleted meanwhile, the index isn't to lose the group over it
+	updateGroup(ctx, -1, map[string]interface{}{"activity": ActivityHigh})
+	if _, found, _ := ddbGetGroup(ctx, -1); found {
+		t.Error("the update created the group")
+	}
+	if len(index.indexed) != 0 || len(index.unindexed) != 0 {
+		t.Errorf("got indexed %v, unindexed %v, want the index untouched", index.indexed, index.unindexed)
+	}
+	if len(outboxChatIDs(t)) != 0 {
+		t.Errorf("the change not made is left in the outbox: %v", outboxChatIDs(t))
+	}
+
+	if _, err := ddbWriteGroup(ctx, GroupRecord{ChatID: -1, Title: "gophers"}); err != nil {
+		t.Fatal(err)
+	}
+	updateGroup(ctx, -1, map[string]interface{}{"activity": ActivityHigh})
+	if g, _, _ := ddbGetGroup(ctx, -1); g.Activity != ActivityHigh || g.Title != "gophers" {
+		t.Errorf("got %+v after the update", g)
+	}
+	if len(index.indexed) != 1 {
+		t.Errorf("got indexed %v, want the updated group", index.indexed)
+	}
+}
+
+func TestWriteGroupStoredDespiteTagIndex(t *testing.T) {
+	f := newFakeDynamoDB(t)
+	index := newStubIndex(t)
+	ctx := context.Background()
+
+	mcache.Set(subscriptionsKey, []SubscriptionRecord{{UserID: 7, Keywords: "gophers"}}, time.Minute)
+	defer mcache.Delete(subscriptionsKey)
+	defer alerts.take()
+
+	// more tags than the transaction of the group, the tags after it fail
+	tags := []string{}
+	for i := 0; i < 30; i++ {
+		tags = append(tags, "tag"+strconv.Itoa(i))
+	}
+	f.failTransactionsFrom = 2
+	writeGroup(ctx, GroupRecord{ChatID: -1, Title: "gophers", Tags: tags, Status: GroupStatusApproved})
+
+	if g, found, _ := ddbGetGroup(ctx, -1); !found || g.Status != GroupStatusApproved {
+		t.Fatalf("got %+v, want the group stored", g)
+	}
+	if len(index.indexed) != 1 || len(outboxChatIDs(t)) != 0 {
+		t.Errorf("got indexed %v, outbox %v, want the group synced", index.indexed, outboxChatIDs(t))
+	}
+	if pending := alerts.take(); len(pending[7]) != 1 {
+		t.Errorf("got alerts %v, want the subscriber alerted of the approved group", pending)
+	}
+}
@@ -3,18 +3,30 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"html"
+	"strconv"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Handler func(ctx context.Context, update *tgbotapi.Update)
 
+const (
+	channelRefreshKey      = "channel:"
+	channelRefreshInterval = 24 * time.Hour
+)
+
 func handleSearch(ctx context.Context, update *tgbotapi.Update) {
 	tokens := strings.Fields(update.Message.Text)
 
-	var rsp string
+	var (
+		rsp    string
+		groups []GroupRecord
+		logID  string
+	)
 	defer func() {
 		if rsp == "" {
 			return
@@ -23,10 +35,10 @@ func handleSearch(ctx context.Context, update *tgbotapi.Update) {
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, rsp)
 		msg.ParseMode = tgbotapi.ModeHTML
 		msg.DisableWebPagePreview = true
-		_, err := bot.Send(msg)
-		if err != nil {
-			log.Println(err)
+		if keyboard := resultKeyboard(groups, 0, logID); keyboard != nil {
+			msg.ReplyMarkup = keyboard
 		}
+		queueMessage(ctx, msg)
 	}()
 
 	keywords := []string{}
@@ -36,31 +48,47 @@ func handleSearch(ctx context.Context, update *tgbotapi.Update) {
 		}
 	}
 
-	groups := opensearchSearchGroup(ctx, keywords)
+	groups = opensearchSearchGroup(ctx, keywords)
+	logID = logSearch(ctx, SearchSourceSearch, keywords, "", 0, len(groups))
+	countStat(StatSearches, 1)
+	if len(groups) == 0 {
+		countStat(StatZeroResultSearches, 1)
+	}
 
 	rsp = `
 找到如下结果:
 
 `
 
+	rsp += formatGroupList(groups, 0)
+	return
+}
+
+// formatGroupList renders the groups as numbered HTML lines, numbering from offset+1
+func formatGroupList(groups []GroupRecord, offset int) string {
+	list := ""
 	for i, g := range groups {
 		icon := "👥"
 		if g.Type == "channel" {
 			icon = "📢"
 		}
-		line := fmt.Sprintf("%d. %s %s - <a href=\"https://t.me/%s\">%s</a>\n", i+1, icon, formatMemberCount(g.MemberCount), g.Username, g.Title)
-		rsp += line
+		if g.Activity == ActivityHigh {
+			icon += "🔥"
+		}
+		line := fmt.Sprintf("%d. %s %s - <a href=\"%s\">%s</a>\n", offset+i+1, icon, formatMemberCount(g.MemberCount), getGroupURL(g), html.EscapeString(g.Title))
+		list += line
 	}
-	return
+	return list
 }
 
 func handleNewUserChat(ctx context.Context, update *tgbotapi.Update) {
 	tguser := update.MyChatMember.From
 	userRecord := UserRecord{
-		ID:        tguser.ID,
-		Username:  tguser.UserName,
-		FirstName: tguser.FirstName,
-		LastName:  tguser.LastName,
+		ID:           tguser.ID,
+		Username:     tguser.UserName,
+		FirstName:    tguser.FirstName,
+		LastName:     tguser.LastName,
+		LanguageCode: tguser.LanguageCode,
 	}
 	ddbWriteUser(ctx, userRecord)
 }
@@ -68,19 +96,78 @@ func handleNewUserChat(ctx context.Context, update *tgbotapi.Update) {
 func handleNewGroupChat(ctx context.Context, update *tgbotapi.Update) {
 	groupChat := update.MyChatMember.Chat
 
-	fmt.Printf("bot was added to a new group, groupID: %v, groupTitle: %v, groupUsername: %v, groupType: %v\n", groupChat.ID, groupChat.Title, groupChat.UserName, groupChat.Type)
+	logger(ctx).Info().Int64("group_id", groupChat.ID).Str("group_username", groupChat.UserName).Str("type", groupChat.Type).Msg("bot added to a group")
 
-	if groupChat.UserName == "" {
-		fmt.Printf("group username is empty, not support indexing private group\n")
+	// whoever added the bot is taken as the submitter
+	indexGroupChat(ctx, groupChat, update.MyChatMember.From.ID)
+}
+
+// handleChannelPost counts the post as the channel's activity and refreshes the indexed channel it's from,
+// the pending, rejected and unindexed channels are left alone as a post is no submission
+func handleChannelPost(ctx context.Context, update *tgbotapi.Update) {
+	channel := update.ChannelPost.Chat
+	if channel == nil {
 		return
 	}
+	trackActivity(ctx, channel.ID, 0)
+
+	// posts are frequent, refresh the channel at most once per interval
+	key := channelRefreshKey + strconv.FormatInt(channel.ID, 10)
+	if err := mcache.Add(key, true, channelRefreshInterval); err != nil {
+		return
+	}
+
+	g, found := getGroup(ctx, channel.ID)
+	if !found || !groupSearchable(g) {
+		return
+	}
+
+	logger(ctx).Info().Int64("group_id", channel.ID).Str("group_username", channel.UserName).Msg("channel post received")
+	// the stored invite link of a private channel is kept rather than a new one created
+	if _, err := refreshGroup(ctx, g); err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", channel.ID).Msg("refresh channel")
+	}
+}
+
+// handleGroupRemovedBot handles the bot being removed from or demoted in a group or channel
+func handleGroupRemovedBot(ctx context.Context, update *tgbotapi.Update) {
+	groupChat := update.MyChatMember.Chat
+
+	logger(ctx).Info().Int64("group_id", groupChat.ID).Str("group_username", groupChat.UserName).Str("type", groupChat.Type).
+		Str("status", update.MyChatMember.NewChatMember.Status).Msg("bot removed or demoted")
+
+	// a public group is still reachable by its username, but the invite link of
+	// a private group is revoked along with the bot's administrator rights
+	if groupChat.UserName == "" {
+		deleteGroup(ctx, groupChat.ID)
+	}
+}
 
-	groupChat, memberCount, err := getGroupInfo(ctx, groupChat.UserName)
+// indexGroupChat indexes a group or channel the bot is in, submitter is 0 if unknown
+func indexGroupChat(ctx context.Context, groupChat tgbotapi.Chat, submitter int64) {
+	var (
+		memberCount int
+		inviteLink  string
+		err         error
+	)
+	if groupChat.UserName != "" {
+		groupChat, memberCount, err = getGroupInfo(ctx, groupChat.UserName)
+	} else {
+		// private group, it's only reachable through an invite link
+		groupChat, memberCount, err = getGroupInfoByID(ctx, groupChat.ID)
+		if err == nil {
+			inviteLink, err = createInviteLink(ctx, groupChat.ID)
+			if err != nil {
+				logger(ctx).Error().Err(err).Int64("group_id", groupChat.ID).Msg("create invite link for private group")
+				sendText(ctx, groupChat.ID, getLocalizedText(ctx, PrivateGroupNeedAdmin))
+				return
+			}
+		}
+	}
 	if err != nil {
-		fmt.Printf("get group info failed, error: %v", err)
+		logger(ctx).Error().Err(err).Int64("group_id", groupChat.ID).Msg("get group info")
 		return
 	}
-	log.Printf("group description: %s\n", groupChat.Description)
 
 	//tags := getGroupTags(ctx, groupChat.Title, groupChat.Description)
 	s := GroupInfo{
@@ -88,34 +175,84 @@ func handleNewGroupChat(ctx context.Context, update *tgbotapi.Update) {
 		MemberCount: memberCount,
 	}
 
-	opensearchWriteGroup(ctx, GroupRecord{
+	record := GroupRecord{
 		Username:    s.UserName,
 		ChatID:      s.ID,
 		Title:       s.Title,
 		Type:        s.Type,
 		Description: s.Description,
 		MemberCount: s.MemberCount,
-	})
+		InviteLink:  inviteLink,
+	}
+	if submitter != 0 {
+		record.Verification = verifyGroupOwnership(ctx, s.ID, submitter)
+	}
+	if submitGroup(ctx, record, submitter, "") == GroupStatusBlocked && submitter != 0 {
+		sendText(ctx, submitter, getLocalizedText(ctx, GroupBlocked))
+	}
 }
 
 func handleUpdate(ctx context.Context, update tgbotapi.Update) {
-	log.Printf("TG Update: %+v\n", update)
+	ctx, span := startSpan(ctx, "handleUpdate", attribute.Int("update_id", update.UpdateID))
+	defer span.End()
+	ctx = withUpdateLogger(ctx, &update)
+	if logger(ctx).Debug().Enabled() {
+		logger(ctx).Debug().RawJSON("update", redactUpdate(&update)).Msg("update received")
+	}
+	recordUpdate(update)
+
+	updateType := determineUpdateType(ctx, &update)
+	defer observeUpdate(&update, updateType, time.Now())
+	// the work started in the background is finished before the update counts as handled, deferred after
+	// observeUpdate so the wait is observed too
+	ctx, work := withBackgroundWork(ctx)
+	defer work.wait()
+	span.SetAttributes(attribute.String("update_type", getUpdateTypeName(&update, updateType)))
 
-	// new user started with the bot
-	if determineUpdateType(ctx, &update) == UpdateType_UserUnblockedBot {
+	switch updateType {
+	case UpdateType_UserUnblockedBot:
+		// new user started with the bot
 		handleNewUserChat(ctx, &update)
 		return
+	case UpdateType_UserBlockedBot:
+		ddbMarkUserInactive(ctx, update.MyChatMember.From.ID)
+		return
+	case UpdateType_GroupAddedBot, UpdateType_GroupPromotedBot, UpdateType_ChannelAddedBot:
+		// the bot is added into a new group or channel, or gets the administrator rights
+		handleNewGroupChat(ctx, &update)
+		return
+	case UpdateType_GroupRemovedBot, UpdateType_GroupDemotedBot, UpdateType_ChannelRemovedBot:
+		handleGroupRemovedBot(ctx, &update)
+		return
+	case UpdateType_ChannelPost:
+		handleChannelPost(ctx, &update)
+		return
 	}
 
-	// the bot is added into a new group
-	if determineUpdateType(ctx, &update) == UpdateType_GroupAddedBot {
-		handleNewGroupChat(ctx, &update)
+	// messages in groups aren't searches, they only count as the group's activity
+	if update.Message != nil && update.Message.Chat != nil && !update.Message.Chat.IsPrivate() && !updateIsCommand(&update) {
+		if update.Message.From != nil {
+			trackActivity(ctx, update.Message.Chat.ID, update.Message.From.ID)
+		}
 		return
 	}
 
 	var chatID int64
 	if chatID = getChatIDFromUpdate(&update); chatID == 0 {
-		log.Println("not chatID found, unsupported update type")
+		logger(ctx).Warn().Msg("no chat ID found, unsupported update type")
+		return
+	}
+
+	// throttle the users flooding us before anything reaches opensearch or the bot API
+	if !allowUpdate(ctx, &update) {
+		return
+	}
+	if user := getUserFromUpdate(&update); user != nil {
+		trackActiveUser(user.ID)
+	}
+
+	// inline buttons that don't belong to a command's state machine
+	if update.CallbackQuery != nil && handleCallback(ctx, &update) {
 		return
 	}
 
@@ -134,6 +271,9 @@ func handleUpdate(ctx context.Context, update tgbotapi.Update) {
 	}
 
 	if s != nil {
+		if !updateIsCommand(&update) {
+			ctx = withCommandLogger(ctx, s.Command)
+		}
 		h := getCommandHandler(s.Command)
 		h(ctx, &update, s)
 		return
@@ -143,6 +283,6 @@ func handleUpdate(ctx context.Context, update tgbotapi.Update) {
 	if update.Message != nil && update.Message.Text != "" {
 		handleSearch(ctx, &update)
 	} else {
-		fmt.Println("unsupported update")
+		logger(ctx).Warn().Msg("unsupported update")
 	}
 }
@@ -8,6 +8,10 @@ const (
 	GroupLinkInvalid = "GroupLinkInvalid"
 	GroupNotFound    = "GroupNotFound"
 	TopicInvalid     = "TopicInvalid"
+	GroupNotIndexed  = "GroupNotIndexed"
+	GroupBlocked     = "GroupBlocked"
+	PermissionDenied = "PermissionDenied"
+	OwnershipFailed  = "OwnershipFailed"
 
 	// promptting messages
 	InputGroupLink = "InputGroupLink"
@@ -15,8 +19,102 @@ const (
 	TopicChoosing  = "TopicChoosing"
 
 	// result
-	IndexFailed  = "IndexFailed"
-	IndexSuccess = "IndexSuccess"
+	IndexFailed        = "IndexFailed"
+	IndexSuccess       = "IndexSuccess"
+	IndexPendingReview = "IndexPendingReview"
+
+	// private group
+	PrivateGroupAddBot    = "PrivateGroupAddBot"
+	PrivateGroupNeedAdmin = "PrivateGroupNeedAdmin"
+
+	// moderation
+	NoPendingSubmission = "NoPendingSubmission"
+	AlreadyReviewed     = "AlreadyReviewed"
+	SubmissionApproved  = "SubmissionApproved"
+	SubmissionRejected  = "SubmissionRejected"
+
+	// report
+	ReportReasonChoosing = "ReportReasonChoosing"
+	ReportReceived       = "ReportReceived"
+	AlreadyReported      = "AlreadyReported"
+	ReportTooFrequent    = "ReportTooFrequent"
+
+	// ranking
+	TopTitle      = "TopTitle"
+	TrendingTitle = "TrendingTitle"
+	RankEmpty     = "RankEmpty"
+
+	// categories
+	CategoryChoosing = "CategoryChoosing"
+	CategoryAll      = "CategoryAll"
+	Back             = "Back"
+
+	// group detail
+	GroupUsage        = "GroupUsage"
+	DetailMembers     = "DetailMembers"
+	DetailCategory    = "DetailCategory"
+	DetailTags        = "DetailTags"
+	DetailActivity    = "DetailActivity"
+	DetailHistory     = "DetailHistory"
+	DetailIndexedAt   = "DetailIndexedAt"
+	DetailRefreshedAt = "DetailRefreshedAt"
+	DetailJoin        = "DetailJoin"
+	DetailReport      = "DetailReport"
+	DetailSimilar     = "DetailSimilar"
+	SimilarGroups     = "SimilarGroups"
+	NoSimilarGroup    = "NoSimilarGroup"
+
+	// subscriptions
+	InputSubscriptionKeywords   = "InputSubscriptionKeywords"
+	SubscriptionKeywordsInvalid = "SubscriptionKeywordsInvalid"
+	TooManySubscriptions        = "TooManySubscriptions"
+	Subscribed                  = "Subscribed"
+	Unsubscribed                = "Unsubscribed"
+	NoSubscription              = "NoSubscription"
+	SubscriptionList            = "SubscriptionList"
+	SubscriptionAlert           = "SubscriptionAlert"
+
+	// my groups
+	MyGroupsTitle          = "MyGroupsTitle"
+	MyGroupsEmpty          = "MyGroupsEmpty"
+	MyGroupStatus          = "MyGroupStatus"
+	MyGroupCategory        = "MyGroupCategory"
+	MyGroupTags            = "MyGroupTags"
+	MyGroupRefresh         = "MyGroupRefresh"
+	MyGroupRemove          = "MyGroupRemove"
+	MyGroupRemoveConfirm   = "MyGroupRemoveConfirm"
+	MyGroupRemoved         = "MyGroupRemoved"
+	MyGroupUpdated         = "MyGroupUpdated"
+	MyGroupRefreshTooOften = "MyGroupRefreshTooOften"
+	InputGroupTags         = "InputGroupTags"
+	GroupTagsInvalid       = "GroupTagsInvalid"
+
+	// rate limiting
+	SlowDown = "SlowDown"
+
+	// broadcast
+	InputBroadcastText    = "InputBroadcastText"
+	BroadcastInvalid      = "BroadcastInvalid"
+	BroadcastControl      = "BroadcastControl"
+	BroadcastAllUsers     = "BroadcastAllUsers"
+	BroadcastSendButton   = "BroadcastSendButton"
+	BroadcastPauseButton  = "BroadcastPauseButton"
+	BroadcastResumeButton = "BroadcastResumeButton"
+	BroadcastCancelButton = "BroadcastCancelButton"
+
+	// stats
+	StatsTitle = "StatsTitle"
+
+	// search log
+	SearchLogUsage      = "SearchLogUsage"
+	SearchLogFrequent   = "SearchLogFrequent"
+	SearchLogZeroResult = "SearchLogZeroResult"
+
+	// blocklist
+	BlockUsage           = "BlockUsage"
+	BlocklistEmpty       = "BlocklistEmpty"
+	BlocklistUpdated     = "BlocklistUpdated"
+	BlockedGroupsRemoved = "BlockedGroupsRemoved"
 )
 
 const (
@@ -25,6 +123,8 @@ const (
 
     e.g. https://t.me/nightyworld
     e.g. nightyworld
+
+    私有群组请直接将机器人添加到群组并设为管理员
     `
 
 	InputTagsCN = `
@@ -57,6 +157,22 @@ var (
 			"en": "find no group or channel, please check your input",
 			"zh": "未找到群组或频道, 请检查你的输入",
 		},
+		GroupNotIndexed: {
+			"en": "the group or channel isn't indexed",
+			"zh": "该群组或频道未被收录",
+		},
+		GroupBlocked: {
+			"en": "sorry, this group or channel can't be indexed",
+			"zh": "抱歉, 该群组或频道不允许被收录",
+		},
+		PermissionDenied: {
+			"en": "sorry, you are not permitted to do this",
+			"zh": "抱歉, 你没有权限执行此操作",
+		},
+		OwnershipFailed: {
+			"en": "sorry, only the creator or an administrator of the group or channel can add it",
+			"zh": "抱歉, 只有群组或频道的创建者或管理员才能收录它",
+		},
 		InputGroupLink: {
 			"en": "please input your group link",
 			"zh": InputGroupLinkCN,
@@ -81,6 +197,278 @@ var (
 			"en": "%s has been indexed",
 			"zh": IndexSuccessCN,
 		},
+		IndexPendingReview: {
+			"en": "%s is submitted for review, it will be searchable once approved",
+			"zh": "%s 已提交人工审核, 审核通过后即可被搜索到",
+		},
+		PrivateGroupAddBot: {
+			"en": "private groups can't be indexed by the invite link, please add the bot into the group as an administrator with the invite users permission",
+			"zh": "私有群组无法通过邀请链接收录, 请将机器人添加到群组并设为管理员(需要邀请用户权限)",
+		},
+		PrivateGroupNeedAdmin: {
+			"en": "to index this private group, please promote the bot to an administrator with the invite users permission",
+			"zh": "要收录此私有群组, 请将机器人设为管理员并授予邀请用户权限",
+		},
+		NoPendingSubmission: {
+			"en": "no submission is waiting for review",
+			"zh": "没有待审核的群组",
+		},
+		AlreadyReviewed: {
+			"en": "this submission has been reviewed",
+			"zh": "该群组已被审核",
+		},
+		SubmissionApproved: {
+			"en": "%s has been approved and is searchable now",
+			"zh": "%s 已通过审核, 现在可以被搜索到了",
+		},
+		SubmissionRejected: {
+			"en": "%s is rejected, reason: %s",
+			"zh": "%s 未通过审核, 原因: %s",
+		},
+		ReportReasonChoosing: {
+			"en": "why do you report %s?",
+			"zh": "请选择举报 %s 的原因",
+		},
+		ReportReceived: {
+			"en": "thanks, your report has been received",
+			"zh": "感谢, 我们已收到你的举报",
+		},
+		AlreadyReported: {
+			"en": "you have reported this group",
+			"zh": "你已经举报过该群组",
+		},
+		ReportTooFrequent: {
+			"en": "you are reporting too frequently, please try again later",
+			"zh": "举报过于频繁, 请稍后再试",
+		},
+		TopTitle: {
+			"en": "Most popular:",
+			"zh": "最受欢迎:",
+		},
+		TrendingTitle: {
+			"en": "Growing fastest in the recent days:",
+			"zh": "近期增长最快:",
+		},
+		RankEmpty: {
+			"en": "no group found",
+			"zh": "暂无结果",
+		},
+		CategoryChoosing: {
+			"en": "choose a category to browse",
+			"zh": "选择要浏览的分类",
+		},
+		CategoryAll: {
+			"en": "📋 All",
+			"zh": "📋 全部",
+		},
+		Back: {
+			"en": "🔙 Back",
+			"zh": "🔙 返回",
+		},
+		GroupUsage: {
+			"en": "usage: /group <group link or username>",
+			"zh": "用法: /group <群组链接或用户名>",
+		},
+		DetailMembers: {
+			"en": "Members",
+			"zh": "成员数",
+		},
+		DetailCategory: {
+			"en": "Category",
+			"zh": "分类",
+		},
+		DetailTags: {
+			"en": "Tags",
+			"zh": "标签",
+		},
+		DetailActivity: {
+			"en": "Activity",
+			"zh": "活跃度",
+		},
+		DetailHistory: {
+			"en": "Member count history",
+			"zh": "成员数变化",
+		},
+		DetailIndexedAt: {
+			"en": "Indexed at",
+			"zh": "收录时间",
+		},
+		DetailRefreshedAt: {
+			"en": "Refreshed at",
+			"zh": "更新时间",
+		},
+		DetailJoin: {
+			"en": "➡️ Join",
+			"zh": "➡️ 加入",
+		},
+		DetailReport: {
+			"en": "⚠️ Report",
+			"zh": "⚠️ 举报",
+		},
+		DetailSimilar: {
+			"en": "🔍 Similar groups",
+			"zh": "🔍 相似群组",
+		},
+		SimilarGroups: {
+			"en": "groups similar to %s:",
+			"zh": "与 %s 相似的群组:",
+		},
+		NoSimilarGroup: {
+			"en": "no similar group found",
+			"zh": "没有找到相似的群组",
+		},
+		InputSubscriptionKeywords: {
+			"en": "please input up to 3 keywords separated by space, you'll be alerted of the new groups mentioning all of them",
+			"zh": "请输入最多 3 个关键词, 以空格分割. 有同时包含这些关键词的新群组被收录时, 你会收到通知",
+		},
+		SubscriptionKeywordsInvalid: {
+			"en": "invalid keywords, up to 3 keywords of letters, numbers and CJK characters, please re-input",
+			"zh": "关键词非法, 最多 3 个由字母, 数字或中文组成的关键词, 请重新输入",
+		},
+		TooManySubscriptions: {
+			"en": "you can have %d subscriptions at most, please /unsubscribe some first",
+			"zh": "最多只能订阅 %d 组关键词, 请先 /unsubscribe 取消部分订阅",
+		},
+		Subscribed: {
+			"en": "subscribed: %s",
+			"zh": "已订阅: %s",
+		},
+		Unsubscribed: {
+			"en": "unsubscribed",
+			"zh": "已取消订阅",
+		},
+		NoSubscription: {
+			"en": "you have no subscription, use /subscribe to add one",
+			"zh": "你还没有订阅, 使用 /subscribe 添加订阅",
+		},
+		SubscriptionList: {
+			"en": "your subscriptions, tap to remove:",
+			"zh": "你的订阅, 点击按钮取消:",
+		},
+		SubscriptionAlert: {
+			"en": "new groups matching your subscriptions:",
+			"zh": "有符合你订阅的新群组:",
+		},
+		MyGroupsTitle: {
+			"en": "groups you submitted, tap to manage:",
+			"zh": "你提交的群组, 点击按钮管理:",
+		},
+		MyGroupsEmpty: {
+			"en": "you haven't submitted any group, use /add to submit one",
+			"zh": "你还没有提交过群组, 使用 /add 提交",
+		},
+		MyGroupStatus: {
+			"en": "Status",
+			"zh": "状态",
+		},
+		MyGroupCategory: {
+			"en": "📂 Category",
+			"zh": "📂 修改分类",
+		},
+		MyGroupTags: {
+			"en": "🏷 Tags",
+			"zh": "🏷 修改标签",
+		},
+		MyGroupRefresh: {
+			"en": "🔄 Refresh",
+			"zh": "🔄 刷新",
+		},
+		MyGroupRemove: {
+			"en": "🗑 Remove",
+			"zh": "🗑 删除",
+		},
+		MyGroupRemoveConfirm: {
+			"en": "⚠️ Confirm removal",
+			"zh": "⚠️ 确认删除",
+		},
+		MyGroupRemoved: {
+			"en": "%s is removed",
+			"zh": "%s 已删除",
+		},
+		MyGroupUpdated: {
+			"en": "updated",
+			"zh": "已更新",
+		},
+		MyGroupRefreshTooOften: {
+			"en": "refreshed recently, please try again later",
+			"zh": "刚刚刷新过, 请稍后再试",
+		},
+		InputGroupTags: {
+			"en": "please input up to %d tags separated by space",
+			"zh": "请输入最多 %d 个标签, 以空格分割",
+		},
+		GroupTagsInvalid: {
+			"en": "invalid tags, up to %d tags of letters, numbers and CJK characters, please re-input",
+			"zh": "标签非法, 最多 %d 个由字母, 数字或中文组成的标签, 请重新输入",
+		},
+		SlowDown: {
+			"en": "you're going too fast, please slow down and try again later",
+			"zh": "操作太频繁了, 请稍后再试",
+		},
+		InputBroadcastText: {
+			"en": "please input the message to broadcast, HTML is supported",
+			"zh": "请输入要广播的消息, 支持 HTML 格式",
+		},
+		BroadcastInvalid: {
+			"en": "the message can't be sent: %v",
+			"zh": "消息无法发送: %v",
+		},
+		BroadcastControl: {
+			"en": "broadcast %s\ntarget: %s\nstatus: %s\nsent: %d, failed: %d, blocked: %d, skipped: %d",
+			"zh": "广播 %s\n目标: %s\n状态: %s\n成功: %d, 失败: %d, 已屏蔽: %d, 跳过: %d",
+		},
+		BroadcastAllUsers: {
+			"en": "all users",
+			"zh": "所有用户",
+		},
+		BroadcastSendButton: {
+			"en": "📣 Send",
+			"zh": "📣 发送",
+		},
+		BroadcastPauseButton: {
+			"en": "⏸ Pause",
+			"zh": "⏸ 暂停",
+		},
+		BroadcastResumeButton: {
+			"en": "▶️ Resume",
+			"zh": "▶️ 继续",
+		},
+		BroadcastCancelButton: {
+			"en": "⏹ Cancel",
+			"zh": "⏹ 取消",
+		},
+		StatsTitle: {
+			"en": "📊 usage stats (UTC)",
+			"zh": "📊 使用统计 (UTC)",
+		},
+		SearchLogUsage: {
+			"en": "usage: /searchlog [days], up to %d days",
+			"zh": "用法: /searchlog [天数], 最多 %d 天",
+		},
+		SearchLogFrequent: {
+			"en": "most frequent queries of the last %d days",
+			"zh": "最近 %d 天最常见的搜索",
+		},
+		SearchLogZeroResult: {
+			"en": "zero-result queries of the last %d days",
+			"zh": "最近 %d 天无结果的搜索",
+		},
+		BlockUsage: {
+			"en": "usage: /block|/unblock username|chat|keyword <value>\ne.g. /block username *casino*",
+			"zh": "用法: /block|/unblock username|chat|keyword <值>\n例如: /block username *casino*",
+		},
+		BlocklistEmpty: {
+			"en": "the blocklist is empty",
+			"zh": "黑名单为空",
+		},
+		BlocklistUpdated: {
+			"en": "the blocklist is updated",
+			"zh": "黑名单已更新",
+		},
+		BlockedGroupsRemoved: {
+			"en": "%d indexed groups matching the entry are removed",
+			"zh": "已移除 %d 个匹配该条目的已收录群组",
+		},
 	}
 
 	startContent = map[string]string{
@@ -91,6 +479,14 @@ or choose a command following suit your needs:
 
 /start     - start using / show this help info
 /add       - index group
+/top       - most popular groups, e.g. /top channel, /top Programming
+/trending  - fastest growing groups
+/categories - browse groups by category
+/group     - show the details of a group
+/subscribe - get alerted of new groups by keywords
+/subscriptions - list or remove your subscriptions
+/mygroups  - manage the groups you submitted
+/report    - report a dead, scam or spam group
         `,
 		"zh": `
 收录群组:
@@ -108,6 +504,14 @@ TeleEye 机器人提供两种方式收录你的群组
 
 /start     - 开始使用
 /add       - 添加群组
+/top       - 最受欢迎的群组, 如 /top channel, /top Programming
+/trending  - 近期增长最快的群组
+/categories - 按分类浏览群组
+/group     - 查看群组详情
+/subscribe - 订阅关键词, 有新群组时通知你
+/subscriptions - 查看或取消订阅
+/mygroups  - 管理你提交的群组
+/report    - 举报失效或违规的群组
         `,
 	}
 )
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const redactedValue = "[redacted]"
+
+// the personal fields of an update, they're redacted before the update is logged
+var redactedFields = map[string]bool{
+	"first_name":   true,
+	"last_name":    true,
+	"username":     true,
+	"phone_number": true,
+	"email":        true,
+	"bio":          true,
+	"vcard":        true,
+	"text":         true,
+	"caption":      true,
+	"query":        true,
+}
+
+// baseLogger writes JSON lines for CloudWatch, the level is configured by LOG_LEVEL, info by default
+var baseLogger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+// logger gets the logger of ctx, which tags the lines with the update being handled,
+// or the base logger outside of an update
+func logger(ctx context.Context) *zerolog.Logger {
+	if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return &baseLogger
+}
+
+// withUpdateLogger returns a ctx logging every line with the update_id, chat_id and the command if it's one
+func withUpdateLogger(ctx context.Context, update *tgbotapi.Update) context.Context {
+	c := logger(ctx).With().Int("update_id", update.UpdateID)
+	if chatID := getChatIDFromUpdate(update); chatID != 0 {
+		c = c.Int64("chat_id", chatID)
+	} else if update.MyChatMember != nil {
+		c = c.Int64("chat_id", update.MyChatMember.Chat.ID)
+	} else if update.ChannelPost != nil && update.ChannelPost.Chat != nil {
+		c = c.Int64("chat_id", update.ChannelPost.Chat.ID)
+	}
+	if updateIsCommand(update) {
+		c = c.Str("command", update.Message.Command())
+	}
+	// the lines of an update can be found by its trace and vice versa
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		c = c.Str("trace_id", sc.TraceID().String())
+	}
+	l := c.Logger()
+	return l.WithContext(ctx)
+}
+
+// withCommandLogger returns a ctx logging every line with the command, for the inputs of a command's
+// state machine which aren't commands themselves
+func withCommandLogger(ctx context.Context, command string) context.Context {
+	l := logger(ctx).With().Str("command", command).Logger()
+	return l.WithContext(ctx)
+}
+
+// redactUpdate renders the update as JSON with the personal fields redacted
+func redactUpdate(update *tgbotapi.Update) []byte {
+	raw, err := json.Marshal(update)
+	if err != nil {
+		return []byte("null")
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return []byte("null")
+	}
+	redacted, _ := json.Marshal(redactValue(v))
+	return redacted
+}
+
+// redactValue replaces the values of the personal fields found at any depth
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if redactedFields[k] {
+				v[k] = redactedValue
+			} else {
+				v[k] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return v
+}
+
+func init() {
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+	level, err := zerolog.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil || level == zerolog.NoLevel {
+		level = zerolog.InfoLevel
+	}
+	baseLogger = baseLogger.Level(level)
+
+	// whatever still logs through the standard logger, e.g. the bot API's debug output, ends up as JSON too
+	log.SetFlags(0)
+	log.SetOutput(baseLogger)
+	tgbotapi.SetLogger(log.New(baseLogger, "", 0))
+}
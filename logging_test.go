@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+)
+
+func TestRedactUpdate(t *testing.T) {
+	update := tgbotapi.Update{
+		UpdateID: 7,
+		Message: &tgbotapi.Message{
+			From: &tgbotapi.User{ID: 42, FirstName: "Alice", LastName: "Smith", UserName: "alice"},
+			Chat: &tgbotapi.Chat{ID: 42, Type: "private", UserName: "alice"},
+			Text: "golang groups",
+		},
+	}
+	redacted := string(redactUpdate(&update))
+	for _, personal := range []string{"Alice", "Smith", "alice", "golang groups"} {
+		if strings.Contains(redacted, personal) {
+			t.Errorf("%q not redacted: %s", personal, redacted)
+		}
+	}
+
+	var v struct {
+		UpdateID int `json:"update_id"`
+		Message  struct {
+			From struct {
+				ID        int64  `json:"id"`
+				FirstName string `json:"first_name"`
+			} `json:"from"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(redacted), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.UpdateID != 7 || v.Message.From.ID != 42 || v.Message.From.FirstName != redactedValue {
+		t.Errorf("unexpected redacted update: %s", redacted)
+	}
+}
+
+func TestWithUpdateLogger(t *testing.T) {
+	var buf bytes.Buffer
+	base := zerolog.New(&buf)
+	ctx := base.WithContext(context.Background())
+
+	update := tgbotapi.Update{
+		UpdateID: 9,
+		Message: &tgbotapi.Message{
+			Chat:     &tgbotapi.Chat{ID: 42},
+			Text:     "/add golang",
+			Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 4}},
+		},
+	}
+	ctx = withUpdateLogger(ctx, &update)
+	logger(ctx).Info().Msg("hello")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["update_id"] != float64(9) || line["chat_id"] != float64(42) || line["command"] != "add" || line["level"] != "info" {
+		t.Errorf("unexpected log line: %s", buf.String())
+	}
+}
@@ -2,29 +2,156 @@ package main
 
 import (
 	"context"
-	"log"
+	"flag"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 var bot *tgbotapi.BotAPI
 
+// the longest a posted update is handled for, the handling isn't cut short by telegram dropping the connection
+const webhookUpdateTimeout = time.Minute
+
 func main() {
+	replayFile := flag.String("replay", "", "replay the updates recorded in the given JSONL file instead of polling telegram")
+	fakeTelegram := flag.Bool("fake-telegram", false, "serve the telegram bot API from an in-process fake, only used with -replay")
+	refresh := flag.Bool("refresh", false, "refresh all the indexed groups and exit, to be run periodically")
+	reindex := flag.Bool("reindex", false, "rebuild the search index from the groups table in dynamodb and exit")
+	importFromIndex := flag.Bool("import-groups", false, "copy the indexed groups missing from the groups table into it and exit, to set up the table once")
+	repair := flag.Bool("repair-tags", false, "rebuild the tags table from the groups table in dynamodb and exit")
+	webhook := flag.Bool("webhook", false, "receive the updates posted by telegram to /bot<token> on HTTP_ADDR instead of polling")
+	flag.Parse()
+
+	stopTracing := startTracing()
+	defer stopTracing()
+
+	// the replayed updates were recorded already, recording them again into the replayed file would never end
+	if *replayFile != "" && recorder != nil {
+		baseLogger.Info().Msg("update recording disabled during replay")
+		recorder.close()
+		recorder = nil
+	}
+	if recorder != nil {
+		defer recorder.close()
+	}
+
+	// the index maintenance doesn't need the bot
+	if *importFromIndex {
+		if err := importGroups(context.Background()); err != nil {
+			baseLogger.Fatal().Err(err).Msg("import groups")
+		}
+		return
+	}
+	if *repair {
+		if err := repairTags(context.Background()); err != nil {
+			baseLogger.Fatal().Err(err).Msg("repair tags")
+		}
+		return
+	}
+	if *reindex {
+		if err := reindexGroups(context.Background()); err != nil {
+			baseLogger.Fatal().Err(err).Msg("reindex groups")
+		}
+		return
+	}
+
+	// the groups are read from the groups table from here on
+	if err := checkGroupsTable(context.Background()); err != nil {
+		baseLogger.Fatal().Err(err).Msg("check groups table")
+	}
+
 	// initialize tgbot
 	botToken := os.Getenv("BOT_TOKEN")
-	if botToken == "" {
-		log.Fatalln("environment BOT_TOKEN empty!")
+	if botToken == "" && !(*replayFile != "" && *fakeTelegram) {
+		baseLogger.Fatal().Msg("environment BOT_TOKEN empty!")
 	}
 	botDebug := os.Getenv("BOT_DEBUG")
 
+	if *replayFile != "" {
+		var (
+			cleanup func()
+			err     error
+		)
+		bot, cleanup, err = newReplayBot(botToken, *fakeTelegram)
+		if err != nil {
+			baseLogger.Fatal().Err(err).Msg("start replay")
+		}
+		defer cleanup()
+		bot.Client = newThrottledClient(bot.Client)
+		bot.Debug = botDebug == "true"
+
+		sender.start(context.Background())
+		defer sender.close()
+		if err := replayUpdates(context.Background(), *replayFile); err != nil {
+			baseLogger.Error().Err(err).Str("file", *replayFile).Msg("replay")
+		}
+		stats.flush(context.Background())
+		return
+	}
+
 	var err error
 	bot, err = tgbotapi.NewBotAPI(botToken)
 	if err != nil {
-		log.Panic(err)
+		baseLogger.Panic().Err(err).Msg("cannot initialize bot")
 	}
+	bot.Client = newThrottledClient(bot.Client)
 	bot.Debug = botDebug == "true"
 
+	sender.start(context.Background())
+	if *refresh {
+		defer sender.close()
+		if err := refreshGroups(context.Background()); err != nil {
+			baseLogger.Error().Err(err).Msg("refresh groups")
+		}
+		flushOutbox(context.Background())
+		alerts.flush(context.Background())
+		stats.flush(context.Background())
+		return
+	}
+
+	startActivityFlusher(context.Background())
+	startAlertFlusher(context.Background())
+	startOutboxFlusher(context.Background())
+	resumeBroadcasts(context.Background())
+	startStatsFlusher(context.Background())
+
+	// the jobs, e.g. the broadcasts, save their progress on termination to be resumed by the next start
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		baseLogger.Info().Msg("shutting down")
+		jobs.stop()
+		stopTracing()
+		os.Exit(0)
+	}()
+
+	mux := newHTTPMux()
+	if *webhook {
+		// telegram is answered once the update is handled, so a failed update isn't posted again and again
+		mux.HandleFunc("/bot"+botToken, func(w http.ResponseWriter, r *http.Request) {
+			update, err := bot.HandleUpdate(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), webhookUpdateTimeout)
+			defer cancel()
+			handleUpdate(withRequest(ctx), *update)
+		})
+		baseLogger.Info().Str("addr", httpAddr).Msg("serving the webhook")
+		if err := http.ListenAndServe(httpAddr, mux); err != nil {
+			baseLogger.Fatal().Err(err).Msg("serve the webhook")
+		}
+		return
+	}
+	startHTTPServer(context.Background(), mux)
+
 	u := tgbotapi.NewUpdate(-1)
 	u.Timeout = 60
 	updates := bot.GetUpdatesChan(u)
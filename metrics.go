@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace    = "tgbot"
+	readinessTimeout    = 3 * time.Second
+	updateTypeCallback  = "callback_query"
+	updateTypeUnknown   = "unknown"
+	opensearchOpUnknown = "unknown"
+)
+
+// the address serving /metrics, /healthz and /readyz, along with the webhook in webhook mode,
+// configured by HTTP_ADDR
+var httpAddr = ":8080"
+
+var (
+	updatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "updates_total",
+		Help:      "Telegram updates received, by type.",
+	}, []string{"type"})
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time spent handling an update, by type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type"})
+	opensearchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "opensearch_request_duration_seconds",
+		Help:      "OpenSearch request latency, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op"})
+	opensearchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "opensearch_errors_total",
+		Help:      "OpenSearch requests failed or answered with a 5xx, by operation.",
+	}, []string{"op"})
+	dynamodbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "dynamodb_request_duration_seconds",
+		Help:      "DynamoDB call latency including the SDK's retries, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op"})
+	dynamodbErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dynamodb_errors_total",
+		Help:      "DynamoDB calls failed, by operation. Failed conditions aren't errors.",
+	}, []string{"op"})
+	telegramErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "telegram_errors_total",
+		Help:      "Bot API calls failed, by method and HTTP status code, 0 for network errors.",
+	}, []string{"method", "code"})
+	stateCacheItems = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "state_cache_items",
+		Help:      "Items in the in-memory cache of the command states, rate limits and alike.",
+	}, func() float64 { return float64(mcache.ItemCount()) })
+)
+
+var updateTypeNames = map[int]string{
+	UpdateType_TextMessage:       "text_message",
+	UpdateType_CommandMessage:    "command_message",
+	UpdateType_UserBlockedBot:    "user_blocked_bot",
+	UpdateType_UserUnblockedBot:  "user_unblocked_bot",
+	UpdateType_GroupAddedBot:     "group_added_bot",
+	UpdateType_GroupRemovedBot:   "group_removed_bot",
+	UpdateType_GroupPromotedBot:  "group_promoted_bot",
+	UpdateType_GroupDemotedBot:   "group_demoted_bot",
+	UpdateType_ChannelAddedBot:   "channel_added_bot",
+	UpdateType_ChannelRemovedBot: "channel_removed_bot",
+	UpdateType_ChannelPost:       "channel_post",
+}
+
+// getUpdateTypeName names the update type for the metric labels, the button clicks aren't
+// an update type of their own but worth telling apart
+func getUpdateTypeName(update *tgbotapi.Update, updateType int) string {
+	if name, ok := updateTypeNames[updateType]; ok {
+		return name
+	}
+	if update.CallbackQuery != nil {
+		return updateTypeCallback
+	}
+	return updateTypeUnknown
+}
+
+// observeUpdate counts the update and records how long it took to handle, to be deferred with the start time
+func observeUpdate(update *tgbotapi.Update, updateType int, start time.Time) {
+	name := getUpdateTypeName(update, updateType)
+	updatesTotal.WithLabelValues(name).Inc()
+	handlerDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
+
+// getOpensearchOp names the operation of an OpenSearch request by its API endpoint,
+// e.g. /groups/_search is search and DELETE /groups/_doc/1 is delete
+func getOpensearchOp(method, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range segments {
+		if !strings.HasPrefix(s, "_") {
+			continue
+		}
+		op := strings.TrimPrefix(s, "_")
+		switch {
+		case op == "doc":
+			switch method {
+			case http.MethodGet, http.MethodHead:
+				return "get"
+			case http.MethodDelete:
+				return "delete"
+			default:
+				return "index"
+			}
+		case op == "search" && i+1 < len(segments) && segments[i+1] == "scroll":
+			return "scroll"
+		}
+		return op
+	}
+	if method == "" {
+		return opensearchOpUnknown
+	}
+	return strings.ToLower(method)
+}
+
+// instrumentedTransport records the latency and errors of the OpenSearch requests, each limited to opensearchTimeout
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := getOpensearchOp(req.Method, req.URL.Path)
+	start := time.Now()
+	rsp, err := withRequestTimeout(req, opensearchTimeout, t.next.RoundTrip)
+	opensearchDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	// 4xx are answers, e.g. a document not found
+	if err != nil || rsp.StatusCode >= http.StatusInternalServerError {
+		opensearchErrors.WithLabelValues(op).Inc()
+	}
+	return rsp, err
+}
+
+// addDynamoDBMetrics adds a middleware recording the latency and errors of every DynamoDB call
+func addDynamoDBMetrics(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Metrics",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			op := awsmiddleware.GetOperationName(ctx)
+			start := time.Now()
+			out, md, err := next.HandleInitialize(ctx, in)
+			dynamodbDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+
+			var ccf *types.ConditionalCheckFailedException
+			if err != nil && !errors.As(err, &ccf) {
+				dynamodbErrors.WithLabelValues(op).Inc()
+			}
+			return out, md, err
+		}), middleware.After)
+}
+
+// countTelegramError counts a failed bot API call, a nil rsp for a network error
+func countTelegramError(method string, rsp *http.Response, err error) {
+	code := 0
+	if err == nil {
+		if rsp.StatusCode < http.StatusBadRequest {
+			return
+		}
+		code = rsp.StatusCode
+	}
+	telegramErrors.WithLabelValues(method, strconv.Itoa(code)).Inc()
+}
+
+// healthzHandler tells the process is alive
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// readyzHandler tells the bot is initialized and opensearch is reachable, dynamodb has no cheap
+// ping and its failures show in the metrics
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if bot == nil {
+		http.Error(w, "bot not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	rsp, err := opensvc.Ping(opensvc.Ping.WithContext(ctx))
+	if err != nil {
+		http.Error(w, "opensearch: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer rsp.Body.Close()
+	if rsp.IsError() {
+		http.Error(w, "opensearch: "+rsp.Status(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// newHTTPMux serves the metrics and the health checks, the webhook is added to it in webhook mode
+func newHTTPMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+	return mux
+}
+
+// startHTTPServer serves the mux in the background until ctx is done
+func startHTTPServer(ctx context.Context, mux *http.ServeMux) {
+	server := &http.Server{Addr: httpAddr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger(ctx).Error().Err(err).Str("addr", httpAddr).Msg("http server on")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+}
+
+func init() {
+	prometheus.MustRegister(updatesTotal, handlerDuration, opensearchDuration, opensearchErrors,
+		dynamodbDuration, dynamodbErrors, telegramErrors, stateCacheItems)
+
+	if v := os.Getenv("HTTP_ADDR"); v != "" {
+		httpAddr = v
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestGetOpensearchOp(t *testing.T) {
+	cases := []struct {
+		method, path, want string
+	}{
+		{"POST", "/groups/_search", "search"},
+		{"POST", "/_search/scroll", "scroll"},
+		{"DELETE", "/_search/scroll", "scroll"},
+		{"PUT", "/groups/_doc/-100123", "index"},
+		{"GET", "/groups/_doc/-100123", "get"},
+		{"DELETE", "/groups/_doc/-100123", "delete"},
+		{"POST", "/groups/_update/-100123", "update"},
+		{"HEAD", "/", "head"},
+	}
+	for _, c := range cases {
+		if got := getOpensearchOp(c.method, c.path); got != c.want {
+			t.Errorf("getOpensearchOp(%s, %s) = %s, want %s", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestGetUpdateTypeName(t *testing.T) {
+	if got := getUpdateTypeName(&tgbotapi.Update{}, UpdateType_CommandMessage); got != "command_message" {
+		t.Errorf("command: got %s", got)
+	}
+	if got := getUpdateTypeName(&tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{}}, -1); got != updateTypeCallback {
+		t.Errorf("callback: got %s", got)
+	}
+	if got := getUpdateTypeName(&tgbotapi.Update{}, -1); got != updateTypeUnknown {
+		t.Errorf("unknown: got %s", got)
+	}
+	for updateType := UpdateType_TextMessage; updateType <= UpdateType_ChannelPost; updateType++ {
+		if _, ok := updateTypeNames[updateType]; !ok {
+			t.Errorf("update type %d has no name", updateType)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// group moderation status
+const (
+	GroupStatusPending  = "pending"
+	GroupStatusApproved = "approved"
+	GroupStatusRejected = "rejected"
+	GroupStatusBlocked  = "blocked" // matches the blocklist, never indexed
+	GroupStatusDead     = "dead"    // no longer exists, found by the refresh
+)
+
+// groups in these statuses are kept out of search
+var hiddenStatuses = []string{GroupStatusPending, GroupStatusRejected, GroupStatusDead}
+
+// why a submission is held for review
+const (
+	ModerationReasonNewSubmission = "new_submission"
+	ModerationReasonUnverified    = VerificationUnverified
+	ModerationReasonReported      = "reported" // hidden after too many user reports
+)
+
+// moderation callback operations
+const (
+	moderationApprove = "approve"
+	moderationReject  = "reject" // asks for a reason
+	moderationReason  = "reason" // rejects with the chosen reason
+)
+
+// how many pending submissions /pending shows at once
+const pendingPageSize = 10
+
+var (
+	RejectReasonSpam  = "spam"
+	RejectReasonScam  = "scam"
+	RejectReasonNSFW  = "nsfw"
+	RejectReasonOther = "other"
+
+	RejectReasons = []string{RejectReasonSpam, RejectReasonScam, RejectReasonNSFW, RejectReasonOther}
+
+	RejectReasonTexts = map[string]map[string]string{
+		RejectReasonSpam: {
+			"en": "Spam",
+			"zh": "垃圾广告",
+		},
+		RejectReasonScam: {
+			"en": "Scam",
+			"zh": "诈骗",
+		},
+		RejectReasonNSFW: {
+			"en": "NSFW",
+			"zh": "色情内容",
+		},
+		RejectReasonOther: {
+			"en": "Other",
+			"zh": "其他",
+		},
+	}
+)
+
+// moderation is only in effect when someone is able to review the submissions
+func moderationEnabled() bool {
+	return len(botAdmins) > 0
+}
+
+// keepsApproval tells whether the group is refreshed without a review on re-submission, the groups
+// indexed before moderation existed have no status and count as approved
+func keepsApproval(old GroupRecord) bool {
+	return old.Status == "" || old.Status == GroupStatusApproved || old.Status == GroupStatusDead
+}
+
+// submitGroup indexes a submitted group and returns its resulting status. Blocklisted groups are refused,
+// other groups are held pending for review if there is a reason or moderation is enabled.
+func submitGroup(ctx context.Context, record GroupRecord, submitterID int64, reason string) string {
+	old, found := getGroup(ctx, record.ChatID)
+	if found {
+		// keep what's derived from the tracked activities
+		record.Activity = old.Activity
+		record.DailyMessages = old.DailyMessages
+		record.DailyActiveUsers = old.DailyActiveUsers
+		if record.Category == "" {
+			record.Category = old.Category
+		}
+		if len(record.Tags) == 0 {
+			record.Tags = old.Tags
+		}
+		record.CreatedAt = old.CreatedAt
+	}
+	// the first submitter keeps managing the listing. A group stored without a submitter, e.g. indexed
+	// before the submitters were recorded, is only taken over by a verified owner.
+	switch {
+	case found && old.SubmitterID != 0:
+		record.SubmitterID = old.SubmitterID
+	case submitterID != 0 && (!found || record.Verification == VerificationVerified):
+		record.SubmitterID = submitterID
+	}
+	record.UpdatedAt = time.Now().Unix()
+	if record.CreatedAt == 0 {
+		record.CreatedAt = record.UpdatedAt
+	}
+
+	if e, blocked := checkBlocklist(ctx, record); blocked {
+		logger(ctx).Info().Int64("group_id", record.ChatID).Str("entry", e.Entry).Msg("group matches the blocklist, refused")
+		// keep it out of the index even if it was indexed before
+		if found {
+			deleteGroup(ctx, record.ChatID)
+		}
+		return GroupStatusBlocked
+	}
+
+	takeMemberSnapshot(ctx, &record)
+	if !found {
+		countIndexedGroup(record)
+	}
+
+	// an approved group isn't reviewed again on re-submission, just refresh it
+	if found && keepsApproval(old) {
+		record.Status = GroupStatusApproved
+		writeGroup(ctx, record)
+		return record.Status
+	}
+
+	if reason == "" && moderationEnabled() {
+		reason = ModerationReasonNewSubmission
+	}
+	if reason == "" {
+		record.Status = GroupStatusApproved
+		writeGroup(ctx, record)
+		return record.Status
+	}
+
+	record.Status = GroupStatusPending
+	writeGroup(ctx, record)
+	ddbEnqueueModeration(ctx, ModerationRecord{
+		ChatID:      record.ChatID,
+		Group:       record,
+		SubmitterID: submitterID,
+		Reason:      reason,
+		CreatedAt:   time.Now().Unix(),
+	})
+	return record.Status
+}
+
+func moderationKeyboard(chatID int64) tgbotapi.InlineKeyboardMarkup {
+	id := strconv.FormatInt(chatID, 10)
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Approve", newCallbackData(CallbackModeration, moderationApprove, id)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Reject", newCallbackData(CallbackModeration, moderationReject, id)),
+		),
+	)
+}
+
+func rejectReasonKeyboard(ctx context.Context, chatID int64) tgbotapi.InlineKeyboardMarkup {
+	id := strconv.FormatInt(chatID, 10)
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for _, r := range RejectReasons {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedReason(ctx, r), newCallbackData(CallbackModeration, moderationReason, id, r)),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func formatModerationRecord(r ModerationRecord) string {
+	return fmt.Sprintf("%s\n%s\n%s: %d\n%s\n\nreason: %s, submitter: %d",
+		r.Group.Title, getGroupURL(r.Group), r.Group.Type, r.Group.MemberCount, r.Group.Description, r.Reason, r.SubmitterID)
+}
+
+func pendingCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	defer clearState(s.ChatID)
+
+	if update.Message == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+
+	if !isBotAdmin(update.Message.From.ID) {
+		sendText(ctx, chatID, getLocalizedText(ctx, PermissionDenied))
+		return
+	}
+
+	records := ddbListModeration(ctx, pendingPageSize)
+	if len(records) == 0 {
+		sendText(ctx, chatID, getLocalizedText(ctx, NoPendingSubmission))
+		return
+	}
+
+	for _, r := range records {
+		msg := tgbotapi.NewMessage(chatID, formatModerationRecord(r))
+		msg.DisableWebPagePreview = true
+		msg.ReplyMarkup = moderationKeyboard(r.ChatID)
+		if _, err := botSend(ctx, msg); err != nil {
+			logger(ctx).Error().Err(err).Msg("send moderation record")
+		}
+	}
+}
+
+func moderationCallbackHandler(ctx context.Context, update *tgbotapi.Update, args []string) {
+	query := update.CallbackQuery
+	if !isBotAdmin(query.From.ID) {
+		answerCallback(ctx, update, getLocalizedText(ctx, PermissionDenied))
+		return
+	}
+	if len(args) < 2 || query.Message == nil {
+		answerCallback(ctx, update, "")
+		return
+	}
+
+	chatID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		answerCallback(ctx, update, "")
+		return
+	}
+
+	r, found := ddbGetModeration(ctx, chatID)
+	if !found {
+		answerCallback(ctx, update, getLocalizedText(ctx, AlreadyReviewed))
+		return
+	}
+
+	// the submitter may have edited them through /mygroups since the submission
+	if g, found := getGroup(ctx, chatID); found {
+		r.Group.Category, r.Group.Tags = g.Category, g.Tags
+	}
+
+	// the reports have been dealt with by the review
+	if r.Reason == ModerationReasonReported && args[0] != moderationReject {
+		ddbClearReports(ctx, chatID)
+	}
+
+	switch args[0] {
+	case moderationApprove:
+		// the blocklist may have grown since the submission
+		if e, blocked := checkBlocklist(ctx, r.Group); blocked {
+			logger(ctx).Info().Int64("group_id", chatID).Str("entry", e.Entry).Msg("group matches the blocklist, approval refused")
+			deleteGroup(ctx, chatID)
+			ddbDeleteModeration(ctx, chatID)
+			notifySubmitter(ctx, r, getLocalizedText(ctx, GroupBlocked))
+			editReviewedMessage(ctx, update, "⛔ blocked: "+e.Entry)
+			break
+		}
+		r.Group.Status = GroupStatusApproved
+		writeGroup(ctx, r.Group)
+		ddbDeleteModeration(ctx, chatID)
+		notifySubmitter(ctx, r, fmt.Sprintf(getLocalizedText(ctx, SubmissionApproved), r.Group.Title))
+		editReviewedMessage(ctx, update, "✅ approved")
+	case moderationReject:
+		edit := tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, rejectReasonKeyboard(ctx, chatID))
+		if _, err := botRequest(ctx, edit); err != nil {
+			logger(ctx).Error().Err(err).Msg("edit reject reasons")
+		}
+	case moderationReason:
+		reason := RejectReasonOther
+		if len(args) > 2 {
+			reason = args[2]
+		}
+		r.Group.Status = GroupStatusRejected
+		writeGroup(ctx, r.Group)
+		ddbDeleteModeration(ctx, chatID)
+		notifySubmitter(ctx, r, fmt.Sprintf(getLocalizedText(ctx, SubmissionRejected), r.Group.Title, getLocalizedReason(ctx, reason)))
+		editReviewedMessage(ctx, update, "❌ rejected: "+reason)
+	}
+	answerCallback(ctx, update, "")
+}
+
+// editReviewedMessage appends the review result to the admin's message and removes the buttons
+func editReviewedMessage(ctx context.Context, update *tgbotapi.Update, result string) {
+	m := update.CallbackQuery.Message
+	text := fmt.Sprintf("%s\n\n%s by %s", m.Text, result, update.CallbackQuery.From.UserName)
+	if _, err := botSend(ctx, tgbotapi.NewEditMessageText(m.Chat.ID, m.MessageID, text)); err != nil {
+		logger(ctx).Error().Err(err).Msg("edit reviewed message")
+	}
+}
+
+func notifySubmitter(ctx context.Context, r ModerationRecord, content string) {
+	if r.SubmitterID == 0 {
+		return
+	}
+	sendText(ctx, r.SubmitterID, content)
+}
+
+func getLocalizedReason(ctx context.Context, reason string) string {
+	if t, ok := RejectReasonTexts[reason]; ok {
+		return t["zh"]
+	}
+	return reason
+}
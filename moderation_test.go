@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSubmitGroupKeepsLegacyGroupSearchable(t *testing.T) {
+	newFakeDynamoDB(t)
+	index := newStubIndex(t)
+	ctx := context.Background()
+
+	saved := botAdmins
+	botAdmins = map[int64]bool{1: true}
+	defer func() { botAdmins = saved }()
+
+	// indexed before moderation existed, so without a status
+	legacy := GroupRecord{ChatID: -1, Username: "gophers", Title: "gophers", SubmitterID: 42, CreatedAt: 1600000000}
+	if _, err := ddbWriteGroup(ctx, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	// re-submitted the way the refresh does, by nobody and without a reason
+	refreshed := legacy
+	refreshed.Title, refreshed.SubmitterID, refreshed.CreatedAt = "Gophers", 0, 0
+	if status := submitGroup(ctx, refreshed, 0, ""); status != GroupStatusApproved {
+		t.Fatalf("got status %q, want approved", status)
+	}
+	g, _, _ := ddbGetGroup(ctx, -1)
+	if !groupSearchable(g) || g.Title != "Gophers" {
+		t.Errorf("got %+v, want the refreshed group searchable", g)
+	}
+	if g.SubmitterID != 42 || g.CreatedAt != 1600000000 {
+		t.Errorf("got submitter %d created at %d, want them kept", g.SubmitterID, g.CreatedAt)
+	}
+	if len(index.indexed) != 1 {
+		t.Errorf("got indexed %v, want the refreshed group", index.indexed)
+	}
+	if _, found := ddbGetModeration(ctx, -1); found {
+		t.Error("the legacy group is queued for review")
+	}
+}
+
+func TestSubmitGroupUnverifiedKeepsOffLegacyGroup(t *testing.T) {
+	newFakeDynamoDB(t)
+	newStubIndex(t)
+	ctx := context.Background()
+
+	saved := botAdmins
+	botAdmins = map[int64]bool{1: true}
+	defer func() { botAdmins = saved }()
+
+	// indexed before the submitters were recorded
+	legacy := GroupRecord{ChatID: -1, Username: "gophers", Title: "gophers", Status: GroupStatusApproved}
+	if _, err := ddbWriteGroup(ctx, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	// re-added by a stranger, whose ownership couldn't be verified
+	stranger := legacy
+	stranger.Verification = VerificationUnverified
+	submitGroup(ctx, stranger, 99, ModerationReasonUnverified)
+	if g, _, _ := ddbGetGroup(ctx, -1); g.SubmitterID != 0 {
+		t.Fatalf("got submitter %d, want the legacy group left without one", g.SubmitterID)
+	}
+	if _, found := getMyGroup(ctx, -1, 99); found {
+		t.Fatal("the stranger manages the legacy group")
+	}
+
+	// re-added by its verified owner
+	owner := legacy
+	owner.Verification = VerificationVerified
+	submitGroup(ctx, owner, 42, "")
+	if _, found := getMyGroup(ctx, -1, 42); !found {
+		t.Fatal("the verified owner doesn't manage the legacy group")
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	myGroupsLimit = 50 // groups /mygroups lists at most
+	maxGroupTags  = 10
+
+	myGroupRefreshKey      = "mygroup-refresh:"
+	myGroupRefreshInterval = 10 * time.Minute // a submitter refreshes a group at most once per interval
+)
+
+// my group callback operations, no operation opens the manage view
+const (
+	myGroupCategory    = "cat"    // lists the categories to choose from
+	myGroupSetCategory = "setcat" // sets the chosen category
+	myGroupTags        = "tags"   // asks for the tags
+	myGroupRefresh     = "refresh"
+	myGroupRemove      = "remove" // asks for confirmation
+	myGroupRemoveOK    = "removeok"
+)
+
+var GroupStatusTexts = map[string]map[string]string{
+	GroupStatusPending: {
+		"en": "⏳ pending review",
+		"zh": "⏳ 审核中",
+	},
+	GroupStatusApproved: {
+		"en": "✅ listed",
+		"zh": "✅ 已收录",
+	},
+	GroupStatusRejected: {
+		"en": "❌ rejected",
+		"zh": "❌ 未通过",
+	},
+	GroupStatusDead: {
+		"en": "💀 dead",
+		"zh": "💀 已失效",
+	},
+}
+
+func getLocalizedStatus(ctx context.Context, status string) string {
+	// groups indexed before moderation have no status
+	if status == "" {
+		status = GroupStatusApproved
+	}
+	if t, ok := GroupStatusTexts[status]; ok {
+		return t["zh"]
+	}
+	return status
+}
+
+// parseGroupTags splits the input into de-duplicated tags, returns nil if any is invalid or there are too many
+func parseGroupTags(input string) []string {
+	dedup := map[string]bool{}
+	tags := []string{}
+	for _, t := range strings.Fields(input) {
+		if !patternGroupTag.MatchString(t) {
+			return nil
+		}
+		if !dedup[strings.ToLower(t)] {
+			dedup[strings.ToLower(t)] = true
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) > maxGroupTags {
+		return nil
+	}
+	return tags
+}
+
+// flattenCategories lists all the categories of the tree, parents ahead of their children
+func flattenCategories(tree []Category) []*Category {
+	categories := []*Category{}
+	for i := range tree {
+		categories = append(categories, &tree[i])
+		categories = append(categories, flattenCategories(tree[i].Children)...)
+	}
+	return categories
+}
+
+// getMyGroup gets the group if it's submitted by the user
+func getMyGroup(ctx context.Context, chatID, userID int64) (GroupRecord, bool) {
+	g, found := getGroup(ctx, chatID)
+	if !found || g.SubmitterID != userID {
+		return GroupRecord{}, false
+	}
+	return g, true
+}
+
+func formatMyGroups(ctx context.Context, groups []GroupRecord) string {
+	var b strings.Builder
+	b.WriteString(getLocalizedText(ctx, MyGroupsTitle) + "\n\n")
+	for i, g := range groups {
+		fmt.Fprintf(&b, "%d. %s  %s\n", i+1, html.EscapeString(g.Title), getLocalizedStatus(ctx, g.Status))
+	}
+	return b.String()
+}
+
+// myGroupsKeyboard has a numbered button for each listed group to manage it
+func myGroupsKeyboard(groups []GroupRecord) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	row := []tgbotapi.InlineKeyboardButton{}
+	for i, g := range groups {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(i+1), newCallbackData(CallbackMyGroup, strconv.FormatInt(g.ChatID, 10))))
+		if len(row) == 5 {
+			rows = append(rows, row)
+			row = []tgbotapi.InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func formatMyGroup(ctx context.Context, g GroupRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>%s</b>\n%s\n\n", html.EscapeString(g.Title), getGroupURL(g))
+	fmt.Fprintf(&b, "%s: %s\n", getLocalizedText(ctx, MyGroupStatus), getLocalizedStatus(ctx, g.Status))
+	category := "-"
+	if g.Category != "" {
+		category = g.Category
+		if c, _ := findCategory(categoryTree, g.Category, nil); c != nil {
+			category = getLocalizedCategory(ctx, c)
+		}
+	}
+	fmt.Fprintf(&b, "%s: %s\n", getLocalizedText(ctx, DetailCategory), html.EscapeString(category))
+	tags := "-"
+	if len(g.Tags) > 0 {
+		tags = strings.Join(g.Tags, " ")
+	}
+	fmt.Fprintf(&b, "%s: %s\n", getLocalizedText(ctx, DetailTags), html.EscapeString(tags))
+	fmt.Fprintf(&b, "%s: %s", getLocalizedText(ctx, DetailRefreshedAt), formatTime(g.UpdatedAt))
+	return b.String()
+}
+
+// myGroupKeyboard has the operations allowed in the group's status, a rejected group can only be removed
+func myGroupKeyboard(ctx context.Context, g GroupRecord) tgbotapi.InlineKeyboardMarkup {
+	id := strconv.FormatInt(g.ChatID, 10)
+	remove := tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, MyGroupRemove), newCallbackData(CallbackMyGroup, id, myGroupRemove))
+	if g.Status == GroupStatusRejected {
+		return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(remove))
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, MyGroupCategory), newCallbackData(CallbackMyGroup, id, myGroupCategory)),
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, MyGroupTags), newCallbackData(CallbackMyGroup, id, myGroupTags)),
+		),
+	}
+	// a pending group is refreshed on review
+	if g.Status != GroupStatusPending {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, MyGroupRefresh), newCallbackData(CallbackMyGroup, id, myGroupRefresh)),
+			remove,
+		))
+	} else {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(remove))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func myGroupCategoryKeyboard(ctx context.Context, g GroupRecord) tgbotapi.InlineKeyboardMarkup {
+	id := strconv.FormatInt(g.ChatID, 10)
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	row := []tgbotapi.InlineKeyboardButton{}
+	for _, c := range flattenCategories(categoryTree) {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(getLocalizedCategory(ctx, c), newCallbackData(CallbackMyGroup, id, myGroupSetCategory, c.Name)))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = []tgbotapi.InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, Back), newCallbackData(CallbackMyGroup, id)),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func myGroupRemoveKeyboard(ctx context.Context, g GroupRecord) tgbotapi.InlineKeyboardMarkup {
+	id := strconv.FormatInt(g.ChatID, 10)
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, MyGroupRemoveConfirm), newCallbackData(CallbackMyGroup, id, myGroupRemoveOK)),
+			tgbotapi.NewInlineKeyboardButtonData(getLocalizedText(ctx, Back), newCallbackData(CallbackMyGroup, id)),
+		),
+	)
+}
+
+// myGroupsCommandHandler lists the groups submitted by the user, it also receives the tags being edited
+func myGroupsCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	if update.Message == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+	userID := update.Message.From.ID
+
+	if s.Stage == MyGroupTagsReceived {
+		g, found := getMyGroup(ctx, s.Chat.ID, userID)
+		if !found {
+			clearState(s.ChatID)
+			sendText(ctx, chatID, getLocalizedText(ctx, GroupNotIndexed))
+			return
+		}
+		tags := parseGroupTags(update.Message.Text)
+		if len(tags) == 0 {
+			sendText(ctx, chatID, fmt.Sprintf(getLocalizedText(ctx, GroupTagsInvalid), maxGroupTags))
+			return
+		}
+		clearState(s.ChatID)
+
+		// written whole to move the group between the tags' indexes
+		g.Tags = tags
+		writeGroup(ctx, g)
+		sendMyGroup(ctx, chatID, g)
+		return
+	}
+
+	defer clearState(s.ChatID)
+
+	groups := ddbListSubmittedGroups(ctx, userID, myGroupsLimit)
+	if len(groups) == 0 {
+		sendText(ctx, chatID, getLocalizedText(ctx, MyGroupsEmpty))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, formatMyGroups(ctx, groups))
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = myGroupsKeyboard(groups)
+	if _, err := botSend(ctx, msg); err != nil {
+		logger(ctx).Error().Err(err).Msg("send my groups")
+	}
+}
+
+// sendMyGroup sends the manage view of the group
+func sendMyGroup(ctx context.Context, chatID int64, g GroupRecord) {
+	msg := tgbotapi.NewMessage(chatID, formatMyGroup(ctx, g))
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = myGroupKeyboard(ctx, g)
+	if _, err := botSend(ctx, msg); err != nil {
+		logger(ctx).Error().Err(err).Msg("send my group")
+	}
+}
+
+// myGroupCallbackHandler manages a group of the user's, args are the group chat ID, the operation and its value
+func myGroupCallbackHandler(ctx context.Context, update *tgbotapi.Update, args []string) {
+	query := update.CallbackQuery
+	if len(args) < 1 || query.Message == nil {
+		answerCallback(ctx, update, "")
+		return
+	}
+	groupID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		answerCallback(ctx, update, "")
+		return
+	}
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+
+	g, found := getMyGroup(ctx, groupID, query.From.ID)
+	if !found {
+		answerCallback(ctx, update, getLocalizedText(ctx, PermissionDenied))
+		return
+	}
+
+	op := ""
+	if len(args) > 1 {
+		op = args[1]
+	}
+
+	toast := ""
+	content, keyboard := formatMyGroup(ctx, g), myGroupKeyboard(ctx, g)
+	switch op {
+	case myGroupCategory:
+		keyboard = myGroupCategoryKeyboard(ctx, g)
+	case myGroupSetCategory:
+		if len(args) < 3 {
+			break
+		}
+		if c, _ := findCategory(categoryTree, args[2], nil); c != nil {
+			if g.Category == "" {
+				countCategorizedGroup(c.Name)
+			}
+			g.Category = c.Name
+			updateGroup(ctx, g.ChatID, map[string]interface{}{"category": c.Name})
+			content, toast = formatMyGroup(ctx, g), getLocalizedText(ctx, MyGroupUpdated)
+		}
+	case myGroupTags:
+		writeState(&CommandState{
+			GroupInfo: GroupInfo{Chat: tgbotapi.Chat{ID: g.ChatID}},
+			ChatID:    chatID,
+			Command:   "mygroups",
+			Stage:     MyGroupTagsReceived,
+		})
+		answerCallback(ctx, update, "")
+		sendText(ctx, chatID, fmt.Sprintf(getLocalizedText(ctx, InputGroupTags), maxGroupTags))
+		return
+	case myGroupRefresh:
+		if g.Status == GroupStatusPending || g.Status == GroupStatusRejected {
+			break
+		}
+		if err := mcache.Add(myGroupRefreshKey+args[0], true, myGroupRefreshInterval); err != nil {
+			answerCallback(ctx, update, getLocalizedText(ctx, MyGroupRefreshTooOften))
+			return
+		}
+		if _, err := refreshGroup(ctx, g); err != nil {
+			logger(ctx).Error().Err(err).Int64("group_id", g.ChatID).Msg("refresh group")
+			answerCallback(ctx, update, getLocalizedText(ctx, IndexFailed))
+			return
+		}
+		if refreshed, found := getGroup(ctx, g.ChatID); found {
+			g = refreshed
+		}
+		content, keyboard, toast = formatMyGroup(ctx, g), myGroupKeyboard(ctx, g), getLocalizedText(ctx, MyGroupUpdated)
+	case myGroupRemove:
+		keyboard = myGroupRemoveKeyboard(ctx, g)
+	case myGroupRemoveOK:
+		deleteGroup(ctx, g.ChatID)
+		ddbDeleteModeration(ctx, g.ChatID)
+		answerCallback(ctx, update, "")
+		edit := tgbotapi.NewEditMessageText(chatID, messageID, fmt.Sprintf(getLocalizedText(ctx, MyGroupRemoved), g.Title))
+		if _, err := botSend(ctx, edit); err != nil {
+			logger(ctx).Error().Err(err).Msg("edit removed group")
+		}
+		return
+	}
+	answerCallback(ctx, update, toast)
+
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, content, keyboard)
+	edit.ParseMode = tgbotapi.ModeHTML
+	edit.DisableWebPagePreview = true
+	if _, err := botSend(ctx, edit); err != nil {
+		logger(ctx).Error().Err(err).Msg("edit my group")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseGroupTags(t *testing.T) {
+	cases := []struct {
+		input string
+		want  []string
+	}{
+		{"golang 编程", []string{"golang", "编程"}},
+		{"  Go  go GO ", []string{"Go"}},
+		{"go c++", nil},
+		{"", []string{}},
+		{"a b c d e f g h i j k", nil},
+	}
+	for _, c := range cases {
+		if got := parseGroupTags(c.input); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseGroupTags(%q) = %v, want %v", c.input, got, c.want)
+		}
+	}
+}
+
+func TestFlattenCategories(t *testing.T) {
+	tree := []Category{
+		{Name: "Tech", Children: []Category{{Name: "Programming"}, {Name: "AI"}}},
+		{Name: "Finance"},
+	}
+	names := []string{}
+	for _, c := range flattenCategories(tree) {
+		names = append(names, c.Name)
+	}
+	want := []string{"Tech", "Programming", "AI", "Finance"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("flattenCategories() = %v, want %v", names, want)
+	}
+}
+
+func TestDdbListSubmittedGroups(t *testing.T) {
+	newFakeDynamoDB(t)
+	ctx := context.Background()
+
+	for _, g := range []GroupRecord{
+		{ChatID: -1, SubmitterID: 42, UpdatedAt: 100},
+		{ChatID: -2, SubmitterID: 42, UpdatedAt: 300, Status: GroupStatusPending},
+		{ChatID: -3, SubmitterID: 43, UpdatedAt: 400},
+		{ChatID: -4, SubmitterID: 42, UpdatedAt: 200, Status: GroupStatusRejected},
+	} {
+		if _, err := ddbWriteGroup(ctx, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chatIDs := func(groups []GroupRecord) []int64 {
+		ids := []int64{}
+		for _, g := range groups {
+			ids = append(ids, g.ChatID)
+		}
+		return ids
+	}
+	if got := chatIDs(ddbListSubmittedGroups(ctx, 42, 10)); !reflect.DeepEqual(got, []int64{-2, -4, -1}) {
+		t.Errorf("got %v, want the groups of the submitter in all statuses, the latest updated first", got)
+	}
+	if got := chatIDs(ddbListSubmittedGroups(ctx, 42, 2)); !reflect.DeepEqual(got, []int64{-2, -4}) {
+		t.Errorf("got %v, want the latest 2", got)
+	}
+}
@@ -5,21 +5,27 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	opensearch "github.com/opensearch-project/opensearch-go"
 	opensearchapi "github.com/opensearch-project/opensearch-go/opensearchapi"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const indexName = "groups"
 
 var opensvc *opensearch.Client
 
-func opensearchWriteGroup(ctx context.Context, r GroupRecord) {
+// opensearchWriteGroup indexes the group, the index is derived from the groups table by syncGroup
+func opensearchWriteGroup(ctx context.Context, r GroupRecord) (err error) {
+	ctx, span := startSpan(ctx, "opensearchWriteGroup", attribute.Int64("group_id", r.ChatID))
+	defer func() { endSpan(span, err) }()
+
 	// Add a document to the index.
 	s, _ := json.Marshal(r)
 	document := strings.NewReader(string(s))
@@ -29,78 +35,371 @@ func opensearchWriteGroup(ctx context.Context, r GroupRecord) {
 		Body:       document,
 	}
 
-	insertResponse, err := req.Do(context.Background(), opensvc)
+	rsp, err := req.Do(ctx, opensvc)
 	if err != nil {
-		fmt.Println("failed to insert document ", err)
-		return
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.IsError() {
+		return fmt.Errorf("insert document: %s", rsp.Status())
 	}
-	fmt.Println(insertResponse)
+	logger(ctx).Debug().Int64("group_id", r.ChatID).Str("status", r.Status).Msg("document indexed")
+	return nil
 }
 
-func opensearchSearchGroup(ctx context.Context, keywords []string) []GroupRecord {
-	// Search for the document.
-	query := strings.Join(keywords, " ")
-	content := `{
-        "size": 10,
+// opensearchDeleteGroup takes the group out of the index, it's fine if it isn't indexed
+func opensearchDeleteGroup(ctx context.Context, chatID int64) error {
+	req := opensearchapi.DeleteRequest{
+		Index:      indexName,
+		DocumentID: strconv.FormatInt(chatID, 10),
+	}
+
+	rsp, err := req.Do(ctx, opensvc)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.IsError() && rsp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("delete document: %s", rsp.Status())
+	}
+	return nil
+}
+
+func opensearchFindGroupByUsername(ctx context.Context, username string) (GroupRecord, bool) {
+	content := fmt.Sprintf(`{
+        "size": 5,
         "query": {
-            "multi_match": {
-                "query": "%s",
-                "fields": ["title", "description"]
-            }
+            "match": { "username": %q }
         }
-    }`
-	content = fmt.Sprintf(content, query)
+    }`, username)
+
+	search := opensearchapi.SearchRequest{
+		Index: []string{indexName},
+		Body:  strings.NewReader(string(content)),
+	}
+
+	rsp, err := search.Do(ctx, opensvc)
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("group_username", username).Msg("search username")
+		return GroupRecord{}, false
+	}
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		return GroupRecord{}, false
+	}
+
+	result, err := decodeSearchResult(rsp.Body)
+	if err != nil {
+		logger(ctx).Error().Err(err).Str("group_username", username).Msg("decode search result")
+		return GroupRecord{}, false
+	}
+
+	// username is analyzed, so check for the exact one
+	for _, g := range result.groups() {
+		if strings.EqualFold(g.Username, username) {
+			return g, true
+		}
+	}
+	return GroupRecord{}, false
+}
+
+// opensearchSimilarGroups finds the searchable groups like the given one by title, description and tags,
+// the groups of the same category rank higher
+func opensearchSimilarGroups(ctx context.Context, g GroupRecord, size int) []GroupRecord {
+	query := map[string]interface{}{
+		"size": size,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"more_like_this": map[string]interface{}{
+						"fields": []string{"title", "description", "tags"},
+						"like": []map[string]interface{}{
+							{"_index": indexName, "_id": strconv.FormatInt(g.ChatID, 10)},
+						},
+						"min_term_freq":   1,
+						"min_doc_freq":    1,
+						"max_query_terms": 25,
+					},
+				},
+				"should": map[string]interface{}{
+					"match": map[string]interface{}{"category": map[string]interface{}{"query": g.Category, "boost": 2}},
+				},
+				"must_not": map[string]interface{}{
+					"terms": map[string]interface{}{"status": hiddenStatuses},
+				},
+			},
+		},
+	}
+	content, _ := json.Marshal(query)
+
+	search := opensearchapi.SearchRequest{
+		Index: []string{indexName},
+		Body:  strings.NewReader(string(content)),
+	}
+
+	rsp, err := search.Do(ctx, opensvc)
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", g.ChatID).Msg("search similar groups")
+		return nil
+	}
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		logger(ctx).Error().Str("status", rsp.Status()).Int64("group_id", g.ChatID).Msg("search similar groups")
+		return nil
+	}
+
+	result, err := decodeSearchResult(rsp.Body)
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", g.ChatID).Msg("decode similar groups")
+		return nil
+	}
+	return result.groups()
+}
+
+// GroupFilter narrows down the groups listed by opensearchListGroups, empty fields are ignored
+type GroupFilter struct {
+	Type        string   // group, supergroup or channel
+	Categories  []string // any of the categories
+	GrowingOnly bool     // only the groups with positive member growth
+}
+
+func (f GroupFilter) clauses() []map[string]interface{} {
+	clauses := []map[string]interface{}{}
+	if f.Type == "group" {
+		// both of the basic groups and supergroups
+		clauses = append(clauses, map[string]interface{}{
+			"terms": map[string]interface{}{"type": []string{"group", "supergroup"}},
+		})
+	} else if f.Type != "" {
+		clauses = append(clauses, map[string]interface{}{
+			"match": map[string]interface{}{"type": f.Type},
+		})
+	}
+	if len(f.Categories) > 0 {
+		should := []map[string]interface{}{}
+		for _, c := range f.Categories {
+			should = append(should, map[string]interface{}{
+				"match": map[string]interface{}{"category": c},
+			})
+		}
+		clauses = append(clauses, map[string]interface{}{
+			"bool": map[string]interface{}{"should": should, "minimum_should_match": 1},
+		})
+	}
+	if f.GrowingOnly {
+		clauses = append(clauses, map[string]interface{}{
+			"range": map[string]interface{}{"member_growth": map[string]interface{}{"gt": 0}},
+		})
+	}
+	return clauses
+}
+
+// opensearchListGroups lists the searchable groups matching the filter, sorted by the field in descending order,
+// it returns a page of the groups and the total number of them
+func opensearchListGroups(ctx context.Context, filter GroupFilter, sortField string, from, size int) ([]GroupRecord, int) {
+	query := map[string]interface{}{
+		"from": from,
+		"size": size,
+		"sort": []map[string]interface{}{
+			{sortField: map[string]interface{}{"order": "desc", "unmapped_type": "long"}},
+		},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filter.clauses(),
+				"must_not": map[string]interface{}{
+					"terms": map[string]interface{}{"status": hiddenStatuses},
+				},
+			},
+		},
+	}
+	content, _ := json.Marshal(query)
 
 	search := opensearchapi.SearchRequest{
 		Index: []string{indexName},
-		Body:  strings.NewReader(content),
+		Body:  strings.NewReader(string(content)),
+	}
+
+	rsp, err := search.Do(ctx, opensvc)
+	if err != nil {
+		logger(ctx).Error().Err(err).Msg("list groups")
+		return nil, 0
+	}
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		logger(ctx).Error().Str("status", rsp.Status()).Msg("list groups")
+		return nil, 0
+	}
+
+	result, err := decodeSearchResult(rsp.Body)
+	if err != nil {
+		logger(ctx).Error().Err(err).Msg("decode group list")
+		return nil, 0
+	}
+	return result.groups(), result.Hits.Total.Value
+}
+
+// opensearchCountGroups counts the indexed groups
+func opensearchCountGroups(ctx context.Context) (int, error) {
+	count := opensearchapi.CountRequest{Index: []string{indexName}}
+	rsp, err := count.Do(ctx, opensvc)
+	if err != nil {
+		return 0, err
 	}
+	defer rsp.Body.Close()
+	if rsp.IsError() {
+		return 0, fmt.Errorf("count groups: %s", rsp.Status())
+	}
+
+	result := struct {
+		Count int `json:"count"`
+	}{}
+	err = json.NewDecoder(rsp.Body).Decode(&result)
+	return result.Count, err
+}
 
-	searchResponse, err := search.Do(context.Background(), opensvc)
+// opensearchScanGroups calls fn with every indexed group
+func opensearchScanGroups(ctx context.Context, fn func(g GroupRecord)) error {
+	search := opensearchapi.SearchRequest{
+		Index:  []string{indexName},
+		Body:   strings.NewReader(`{"size": 500, "query": {"match_all": {}}}`),
+		Scroll: time.Minute,
+	}
+	rsp, err := search.Do(ctx, opensvc)
 	if err != nil {
-		fmt.Println("failed to search document ", err)
-		os.Exit(1)
+		return err
+	}
+
+	for {
+		if rsp.IsError() {
+			rsp.Body.Close()
+			return fmt.Errorf("scan groups: %s", rsp.Status())
+		}
+		result, err := decodeSearchResult(rsp.Body)
+		rsp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		groups := result.groups()
+		if len(groups) == 0 {
+			clear := opensearchapi.ClearScrollRequest{ScrollID: []string{result.ScrollID}}
+			if rsp, err := clear.Do(ctx, opensvc); err == nil {
+				rsp.Body.Close()
+			}
+			return nil
+		}
+		for _, g := range groups {
+			fn(g)
+		}
+
+		scroll := opensearchapi.ScrollRequest{ScrollID: result.ScrollID, Scroll: time.Minute}
+		if rsp, err = scroll.Do(ctx, opensvc); err != nil {
+			return err
+		}
+	}
+}
+
+type searchResult struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source GroupRecord `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func (r searchResult) groups() []GroupRecord {
+	groups := make([]GroupRecord, 0, len(r.Hits.Hits))
+	for _, hit := range r.Hits.Hits {
+		groups = append(groups, hit.Source)
+	}
+	return groups
+}
+
+func decodeSearchResult(body io.Reader) (searchResult, error) {
+	result := searchResult{}
+	err := json.NewDecoder(body).Decode(&result)
+	return result, err
+}
+
+func opensearchSearchGroup(ctx context.Context, keywords []string) []GroupRecord {
+	ctx, span := startSpan(ctx, "opensearchSearchGroup", attribute.Int("keywords", len(keywords)))
+	defer span.End()
+
+	// Search for the document.
+	query := map[string]interface{}{
+		"size": 10,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":  strings.Join(keywords, " "),
+						"fields": []string{"title", "description"},
+					},
+				},
+				"must_not": map[string]interface{}{
+					"terms": map[string]interface{}{"status": hiddenStatuses},
+				},
+				"should": []map[string]interface{}{
+					{"term": map[string]interface{}{"activity": map[string]interface{}{"value": "high", "boost": 2}}},
+					{"term": map[string]interface{}{"activity": map[string]interface{}{"value": "medium", "boost": 1}}},
+				},
+			},
+		},
+	}
+	content, _ := json.Marshal(query)
+
+	search := opensearchapi.SearchRequest{
+		Index: []string{indexName},
+		Body:  strings.NewReader(string(content)),
 	}
 
 	groups := []GroupRecord{}
-	if searchResponse.IsError() {
+	searchResponse, err := search.Do(ctx, opensvc)
+	if err != nil {
+		failSpan(span, err)
+		logger(ctx).Error().Err(err).Msg("search document")
 		return groups
 	}
+	defer searchResponse.Body.Close()
 
-	resp := map[string]interface{}{}
-	if err := json.NewDecoder(searchResponse.Body).Decode(&resp); err != nil {
-		log.Println(searchResponse)
+	if searchResponse.IsError() {
+		failSpan(span, fmt.Errorf("search document: %s", searchResponse.Status()))
 		return groups
 	}
 
-	for _, hit := range resp["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		r := hit.(map[string]interface{})["_source"].(map[string]interface{})
-		rec := GroupRecord{
-			Username:    r["username"].(string),
-			Type:        r["type"].(string),
-			Title:       r["title"].(string),
-			MemberCount: int(r["member_count"].(float64)),
-		}
-		groups = append(groups, rec)
+	result, err := decodeSearchResult(searchResponse.Body)
+	if err != nil {
+		failSpan(span, err)
+		logger(ctx).Error().Err(err).Str("status", searchResponse.Status()).Msg("decode search result")
+		return groups
 	}
-	return groups
+	span.SetAttributes(attribute.Int("results", result.Hits.Total.Value))
+	return result.groups()
 }
 
 func init() {
 	server := os.Getenv("OPENSEARCH_SERVER")
 	if server == "" {
-		log.Fatalln("environment OPENSEARCH_SERVER empty!")
+		baseLogger.Fatal().Msg("environment OPENSEARCH_SERVER empty!")
 	}
 
 	var err error
 	// Initialize the client with SSL/TLS enabled.
 	opensvc, err = opensearch.NewClient(opensearch.Config{
-		Transport: &http.Transport{
+		Transport: &instrumentedTransport{next: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		}},
 		Addresses: []string{server},
 	})
 	if err != nil {
-		log.Panic("cannot initialize", err)
+		baseLogger.Panic().Err(err).Msg("cannot initialize opensearch client")
 	}
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ranking modes
+const (
+	RankTop      = "top"      // by member count
+	RankTrending = "trending" // by member growth
+)
+
+const (
+	rankKey      = "rank:"
+	rankCacheTTL = 10 * time.Minute
+	rankPageSize = 10
+	rankMaxPages = 10
+)
+
+// rankPage is a cached page of a ranking
+type rankPage struct {
+	groups []GroupRecord
+	total  int
+}
+
+// parseRankFilter takes the command argument as a group type or a category
+func parseRankFilter(arg string) string {
+	arg = strings.TrimSpace(arg)
+	switch strings.ToLower(arg) {
+	case "":
+		return ""
+	case "group", "groups", "supergroup":
+		return "group"
+	case "channel", "channels":
+		return "channel"
+	}
+	if c := findCategoryFold(categoryTree, arg); c != nil {
+		return c.Name
+	}
+	return ""
+}
+
+func newGroupFilter(mode, filter string) GroupFilter {
+	f := GroupFilter{GrowingOnly: mode == RankTrending}
+	if filter == "group" || filter == "channel" {
+		f.Type = filter
+	} else if c, _ := findCategory(categoryTree, filter, nil); c != nil {
+		// a category covers its subcategories
+		f.Categories = categoryNames(c)
+	}
+	return f
+}
+
+// getRankPage gets a page of the ranking, pages are cached so heavy traffic doesn't hit opensearch every time
+func getRankPage(ctx context.Context, mode, filter string, page int) rankPage {
+	key := fmt.Sprintf("%s%s:%s:%d", rankKey, mode, filter, page)
+	if x, found := mcache.Get(key); found {
+		return x.(rankPage)
+	}
+
+	sortField := "member_count"
+	if mode == RankTrending {
+		sortField = "member_growth"
+	}
+	groups, total := opensearchListGroups(ctx, newGroupFilter(mode, filter), sortField, page*rankPageSize, rankPageSize)
+	p := rankPage{groups: groups, total: total}
+	mcache.Set(key, p, rankCacheTTL)
+	return p
+}
+
+func formatRankPage(ctx context.Context, mode string, p rankPage, page int) string {
+	if len(p.groups) == 0 {
+		return getLocalizedText(ctx, RankEmpty)
+	}
+
+	title := getLocalizedText(ctx, TopTitle)
+	if mode == RankTrending {
+		title = getLocalizedText(ctx, TrendingTitle)
+	}
+	if mode != RankTrending {
+		return title + "\n\n" + formatGroupList(p.groups, page*rankPageSize)
+	}
+
+	// show the growth after each group
+	content := title + "\n\n"
+	for i, g := range p.groups {
+		line := formatGroupList([]GroupRecord{g}, page*rankPageSize+i)
+		content += fmt.Sprintf("%s 📈+%d\n", strings.TrimSuffix(line, "\n"), g.MemberGrowth)
+	}
+	return content
+}
+
+// pageKeyboard builds the previous/next buttons, nil if there is only one page
+func pageKeyboard(action string, page, total, pageSize int, args ...string) *tgbotapi.InlineKeyboardMarkup {
+	pages := (total + pageSize - 1) / pageSize
+	if pages > rankMaxPages {
+		pages = rankMaxPages
+	}
+	if pages <= 1 {
+		return nil
+	}
+
+	buttons := []tgbotapi.InlineKeyboardButton{}
+	if page > 0 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("⬅️", newCallbackData(action, append(args, strconv.Itoa(page-1))...)))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d/%d", page+1, pages), newCallbackData(action, append(args, strconv.Itoa(page))...)))
+	if page < pages-1 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("➡️", newCallbackData(action, append(args, strconv.Itoa(page+1))...)))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons)
+	return &keyboard
+}
+
+// rankCommandHandler handles /top and /trending, an optional argument filters by group type or category
+func rankCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	defer clearState(s.ChatID)
+
+	if update.Message == nil {
+		return
+	}
+
+	mode := RankTop
+	if s.Command == RankTrending {
+		mode = RankTrending
+	}
+	filter := parseRankFilter(update.Message.CommandArguments())
+
+	p := getRankPage(ctx, mode, filter, 0)
+	logSearch(ctx, mode, nil, filter, 0, p.total)
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, formatRankPage(ctx, mode, p, 0))
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.DisableWebPagePreview = true
+	if keyboard := pageKeyboard(CallbackRank, 0, p.total, rankPageSize, mode, filter); keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	if _, err := botSend(ctx, msg); err != nil {
+		logger(ctx).Error().Err(err).Msg("send rank")
+	}
+}
+
+// rankCallbackHandler turns the pages, args are the mode, the filter and the page
+func rankCallbackHandler(ctx context.Context, update *tgbotapi.Update, args []string) {
+	defer answerCallback(ctx, update, "")
+
+	query := update.CallbackQuery
+	if len(args) < 3 || query.Message == nil {
+		return
+	}
+	mode, filter := args[0], args[1]
+	page, err := strconv.Atoi(args[2])
+	if err != nil || page < 0 || page >= rankMaxPages {
+		return
+	}
+
+	p := getRankPage(ctx, mode, filter, page)
+	logSearch(ctx, mode, nil, filter, page, p.total)
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, formatRankPage(ctx, mode, p, page))
+	edit.ParseMode = tgbotapi.ModeHTML
+	edit.DisableWebPagePreview = true
+	edit.ReplyMarkup = pageKeyboard(CallbackRank, page, p.total, rankPageSize, mode, filter)
+	if _, err := botSend(ctx, edit); err != nil {
+		logger(ctx).Error().Err(err).Msg("edit rank")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestParseRankFilter(t *testing.T) {
+	cases := map[string]string{
+		"":             "",
+		"channels":     "channel",
+		"Supergroup":   "group",
+		"programming":  TopicProgramming,
+		" Blockchain ": TopicBlockchain,
+		"unknown":      "",
+	}
+	for arg, filter := range cases {
+		if got := parseRankFilter(arg); got != filter {
+			t.Errorf("parseRankFilter(%q) = %q, want %q", arg, got, filter)
+		}
+	}
+}
+
+func TestPageKeyboard(t *testing.T) {
+	if pageKeyboard(CallbackRank, 0, 10, 10, RankTop, "") != nil {
+		t.Error("a single page needs no keyboard")
+	}
+
+	keyboard := pageKeyboard(CallbackRank, 1, 25, 10, RankTop, "channel")
+	if keyboard == nil || len(keyboard.InlineKeyboard[0]) != 3 {
+		t.Fatalf("expect previous, current and next buttons, got %+v", keyboard)
+	}
+	if data := *keyboard.InlineKeyboard[0][2].CallbackData; data != "rank:top:channel:2" {
+		t.Errorf("unexpected next page data %s", data)
+	}
+}
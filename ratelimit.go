@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// tokenBucket allows bursts up to its capacity, refilled at a steady rate
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64 // tokens refilled per second
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity int, rate float64) *tokenBucket {
+	return &tokenBucket{capacity: float64(capacity), rate: rate, tokens: float64(capacity)}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
+
+// allow takes a token if there's one
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve takes a token anyway and returns how long to wait until it's actually available
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type rateLimit struct {
+	burst int
+	rate  float64 // per second
+}
+
+const (
+	userBucketKey  = "bucket:"
+	userBucketTTL  = 10 * time.Minute // idle buckets are full again long before they expire
+	slowDownKey    = "slowdown:"
+	slowDownNotice = time.Minute // a throttled user is told to slow down at most once per this
+
+	rateClassAll      = ""         // every update of the user
+	rateClassMessage  = "message"  // searches and the inputs of the commands
+	rateClassCallback = "callback" // inline button clicks
+)
+
+var (
+	// per user limits by the command, or the class of the update if it's not a command
+	userRateLimits = map[string]rateLimit{
+		rateClassAll:      {burst: 30, rate: 1},
+		rateClassMessage:  {burst: 10, rate: 0.5},
+		rateClassCallback: {burst: 20, rate: 2},
+		"add":             {burst: 3, rate: 1.0 / 60},
+		"report":          {burst: 3, rate: 1.0 / 60},
+	}
+	defaultCommandRateLimit = rateLimit{burst: 5, rate: 0.2}
+)
+
+// getRateClass tells which limit the update counts against besides the user's overall one
+func getRateClass(update *tgbotapi.Update) string {
+	switch {
+	case update.CallbackQuery != nil:
+		return rateClassCallback
+	case updateIsCommand(update):
+		return update.Message.Command()
+	default:
+		return rateClassMessage
+	}
+}
+
+func getUserBucket(userID int64, class string) *tokenBucket {
+	key := userBucketKey + strconv.FormatInt(userID, 10) + ":" + class
+	if x, found := mcache.Get(key); found {
+		mcache.Set(key, x, userBucketTTL)
+		return x.(*tokenBucket)
+	}
+
+	limit, ok := userRateLimits[class]
+	if !ok {
+		limit = defaultCommandRateLimit
+	}
+	b := newTokenBucket(limit.burst, limit.rate)
+	mcache.Set(key, b, userBucketTTL)
+	return b
+}
+
+// allowUpdate counts the update against the limits of its user, a throttled user is told to slow down
+func allowUpdate(ctx context.Context, update *tgbotapi.Update) bool {
+	user := getUserFromUpdate(update)
+	if user == nil || isBotAdmin(user.ID) {
+		return true
+	}
+
+	now := time.Now()
+	class := getRateClass(update)
+	if getUserBucket(user.ID, rateClassAll).allow(now) && getUserBucket(user.ID, class).allow(now) {
+		return true
+	}
+
+	if update.CallbackQuery != nil {
+		answerCallback(ctx, update, getLocalizedText(ctx, SlowDown))
+	} else if err := mcache.Add(slowDownKey+strconv.FormatInt(user.ID, 10), true, slowDownNotice); err == nil {
+		sendText(ctx, getChatIDFromUpdate(update), getLocalizedText(ctx, SlowDown))
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllow(t *testing.T) {
+	b := newTokenBucket(2, 1)
+	now := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+
+	if !b.allow(now) || !b.allow(now) {
+		t.Fatal("burst should be allowed")
+	}
+	if b.allow(now) {
+		t.Fatal("empty bucket should refuse")
+	}
+	if !b.allow(now.Add(time.Second)) {
+		t.Fatal("a token should be refilled after a second")
+	}
+	if !b.allow(now.Add(time.Hour)) || !b.allow(now.Add(time.Hour)) || b.allow(now.Add(time.Hour)) {
+		t.Fatal("refill should be capped at the capacity")
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := newTokenBucket(1, 2)
+	now := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+
+	if w := b.reserve(now); w != 0 {
+		t.Fatalf("first reservation should not wait, got %v", w)
+	}
+	if w := b.reserve(now); w != 500*time.Millisecond {
+		t.Fatalf("second reservation should wait 500ms, got %v", w)
+	}
+	if w := b.reserve(now); w != time.Second {
+		t.Fatalf("third reservation should wait 1s, got %v", w)
+	}
+}
+
+func TestIsSendMethod(t *testing.T) {
+	for method, want := range map[string]bool{
+		"sendMessage":         true,
+		"editMessageText":     true,
+		"copyMessage":         true,
+		"getChat":             false,
+		"answerCallbackQuery": false,
+	} {
+		if got := isSendMethod(method); got != want {
+			t.Errorf("isSendMethod(%s) = %v, want %v", method, got, want)
+		}
+	}
+}
+
+func TestGetRequestChatID(t *testing.T) {
+	form := url.Values{"chat_id": {"-1001"}, "text": {"hello"}}.Encode()
+	req, _ := http.NewRequest(http.MethodPost, "https://api.telegram.org/botx/sendMessage", strings.NewReader(form))
+	req.Header.Set("Content-Type", formContentType)
+
+	if chatID := getRequestChatID(req); chatID != -1001 {
+		t.Fatalf("expect chat -1001, got %d", chatID)
+	}
+	if err := req.ParseForm(); err != nil || req.PostForm.Get("text") != "hello" {
+		t.Fatal("request body should be restored")
+	}
+}
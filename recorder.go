@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// updateRecorder appends every raw update as one JSON line to a file,
+// the recorded file can be fed back through handleUpdate by the replay mode
+type updateRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+var recorder *updateRecorder
+
+func newUpdateRecorder(path string) (*updateRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &updateRecorder{
+		file: f,
+		enc:  json.NewEncoder(f),
+	}, nil
+}
+
+func (r *updateRecorder) record(update tgbotapi.Update) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// json.Encoder terminates each value with a newline, so that's a JSONL file
+	if err := r.enc.Encode(update); err != nil {
+		baseLogger.Error().Err(err).Int("update_id", update.UpdateID).Msg("record update")
+	}
+}
+
+func (r *updateRecorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file.Close()
+}
+
+func recordUpdate(update tgbotapi.Update) {
+	if recorder == nil {
+		return
+	}
+	recorder.record(update)
+}
+
+func init() {
+	// recording is optional, only enabled when UPDATE_RECORD_FILE is set
+	path := os.Getenv("UPDATE_RECORD_FILE")
+	if path == "" {
+		return
+	}
+
+	var err error
+	recorder, err = newUpdateRecorder(path)
+	if err != nil {
+		baseLogger.Fatal().Err(err).Str("path", path).Msg("unable to open update record file")
+	}
+}
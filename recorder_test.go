@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestUpdateRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.jsonl")
+	r, err := newUpdateRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.record(tgbotapi.Update{UpdateID: 1})
+	r.record(tgbotapi.Update{UpdateID: 2, Message: &tgbotapi.Message{Text: "hello"}})
+	r.close()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 recorded lines, got %d", len(lines))
+	}
+}
+
+func TestReplayUpdatesMissingFile(t *testing.T) {
+	if err := replayUpdates(context.Background(), filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Fatal("expect error replaying a missing file")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	snapshotDayFormat = "20060102"
+	snapshotWindow    = 7                   // days the member growth is measured over
+	snapshotRetention = 30 * 24 * time.Hour // snapshots expire after this
+)
+
+// takeMemberSnapshot records today's member count of the group and
+// sets its member growth since the oldest snapshot within the window
+func takeMemberSnapshot(ctx context.Context, record *GroupRecord) {
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -snapshotWindow).Format(snapshotDayFormat)
+	if oldest, found := ddbGetOldestSnapshot(ctx, record.ChatID, since); found {
+		record.MemberGrowth = record.MemberCount - oldest.MemberCount
+	}
+
+	ddbWriteSnapshot(ctx, SnapshotRecord{
+		ChatID:      record.ChatID,
+		Day:         now.Format(snapshotDayFormat),
+		MemberCount: record.MemberCount,
+		ExpireAt:    now.Add(snapshotRetention).Unix(),
+	})
+}
+
+// refreshGroup re-crawls the group and re-submits it, a group which no longer exists is marked dead.
+// It returns the resulting status of the group.
+func refreshGroup(ctx context.Context, g GroupRecord) (string, error) {
+	var err error
+	if g.Username != "" {
+		chat, count, e := getGroupInfo(ctx, g.Username)
+		g.Title, g.Type, g.Description, g.MemberCount, err = chat.Title, chat.Type, chat.Description, count, e
+	} else {
+		chat, count, e := getGroupInfoByID(ctx, g.ChatID)
+		g.Title, g.Type, g.Description, g.MemberCount, err = chat.Title, chat.Type, chat.Description, count, e
+	}
+	if errors.Is(err, errGroupNotFound) {
+		logger(ctx).Info().Int64("group_id", g.ChatID).Str("group_username", g.Username).Msg("group is dead")
+		g.Status = GroupStatusDead
+		g.UpdatedAt = time.Now().Unix()
+		writeGroup(ctx, g)
+		return g.Status, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return submitGroup(ctx, g, 0, ""), nil
+}
+
+// refreshGroups re-crawls all the approved and dead groups to update their info and member snapshots,
+// it's meant to be run periodically, e.g. daily by a scheduler
+func refreshGroups(ctx context.Context) error {
+	refreshed, failed := 0, 0
+	err := ddbScanGroups(ctx, func(g GroupRecord) {
+		// dead groups are retried in case they're back
+		if g.Status == GroupStatusPending || g.Status == GroupStatusRejected {
+			return
+		}
+
+		if _, err := refreshGroup(ctx, g); err != nil {
+			logger(ctx).Error().Err(err).Int64("group_id", g.ChatID).Str("group_username", g.Username).Msg("refresh group")
+			failed++
+			return
+		}
+		refreshed++
+
+		// stay well under the bot API rate limits
+		time.Sleep(100 * time.Millisecond)
+	})
+	logger(ctx).Info().Int("refreshed", refreshed).Int("failed", failed).Msg("refresh done")
+	return err
+}
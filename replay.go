@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// the biggest single update line we accept from a record file
+const maxRecordLineSize = 4 * 1024 * 1024
+
+// replayUpdates feeds every update recorded in the JSONL file through handleUpdate in order
+func replayUpdates(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordLineSize)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var update tgbotapi.Update
+		if err := json.Unmarshal([]byte(line), &update); err != nil {
+			logger(ctx).Warn().Err(err).Int("line", lineNo).Msg("replay: skip invalid update")
+			continue
+		}
+
+		logger(ctx).Info().Int("line", lineNo).Int("update_id", update.UpdateID).Msg("replay")
+		handleUpdate(ctx, update)
+	}
+
+	return scanner.Err()
+}
+
+// newFakeTelegramServer serves the subset of the bot API we use with canned results,
+// every call is logged so that a replay shows what the bot would have sent
+func newFakeTelegramServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		baseLogger.Info().Str("method", method).Interface("form", r.PostForm).Msg("fake telegram")
+
+		var result interface{} = true
+		switch method {
+		case "getMe":
+			result = tgbotapi.User{ID: 1, IsBot: true, FirstName: "fakebot", UserName: "fakebot"}
+		case "getChat":
+			chatID := r.PostForm.Get("chat_id")
+			chat := tgbotapi.Chat{Type: "supergroup"}
+			if strings.HasPrefix(chatID, "@") {
+				chat.ID = -1000000000000 - int64(len(chatID))
+				chat.UserName = chatID[1:]
+				chat.Title = chatID[1:]
+			} else {
+				chat.ID, _ = strconv.ParseInt(chatID, 10, 64)
+			}
+			result = chat
+		case "getChatMemberCount", "getChatMembersCount":
+			result = 0
+		case "sendMessage", "editMessageText":
+			chatID, _ := strconv.ParseInt(r.PostForm.Get("chat_id"), 10, 64)
+			result = tgbotapi.Message{
+				MessageID: 1,
+				Date:      int(time.Now().Unix()),
+				Chat:      &tgbotapi.Chat{ID: chatID},
+				Text:      r.PostForm.Get("text"),
+			}
+		}
+
+		raw, _ := json.Marshal(result)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: raw})
+	}))
+}
+
+// newReplayBot creates the bot used for replaying, either against the real API or the fake one
+func newReplayBot(token string, fake bool) (*tgbotapi.BotAPI, func(), error) {
+	if !fake {
+		b, err := tgbotapi.NewBotAPI(token)
+		return b, func() {}, err
+	}
+
+	if token == "" {
+		token = "fake"
+	}
+	server := newFakeTelegramServer()
+	b, err := tgbotapi.NewBotAPIWithAPIEndpoint(token, server.URL+"/bot%s/%s")
+	if err != nil {
+		server.Close()
+		return nil, nil, fmt.Errorf("connect fake telegram: %w", err)
+	}
+	return b, server.Close, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	reportRateKey    = "report:"
+	reportRateWindow = time.Hour
+)
+
+var (
+	// a group is hidden from search until reviewed once it has been reported this many times
+	reportHideThreshold = 3
+	// how many reports a user can make within reportRateWindow
+	reportRateLimit = 5
+
+	ReportReasonDead  = "dead"
+	ReportReasonScam  = "scam"
+	ReportReasonSpam  = "spam"
+	ReportReasonNSFW  = "nsfw"
+	ReportReasonOther = "other"
+
+	ReportReasons = []string{ReportReasonDead, ReportReasonScam, ReportReasonSpam, ReportReasonNSFW, ReportReasonOther}
+
+	ReportReasonTexts = map[string]map[string]string{
+		ReportReasonDead: {
+			"en": "💀 Dead or invalid link",
+			"zh": "💀 链接失效或群组已解散",
+		},
+		ReportReasonScam: {
+			"en": "🎣 Scam",
+			"zh": "🎣 诈骗",
+		},
+		ReportReasonSpam: {
+			"en": "📣 Spam",
+			"zh": "📣 垃圾广告",
+		},
+		ReportReasonNSFW: {
+			"en": "🔞 NSFW",
+			"zh": "🔞 色情内容",
+		},
+		ReportReasonOther: {
+			"en": "❓ Other",
+			"zh": "❓ 其他",
+		},
+	}
+)
+
+// reportAllowed counts a report made by the user and tells whether the user is still within the rate limit
+func reportAllowed(userID int64) bool {
+	key := reportRateKey + strconv.FormatInt(userID, 10)
+	if err := mcache.Add(key, 1, reportRateWindow); err == nil {
+		return true
+	}
+	n, err := mcache.IncrementInt(key, 1)
+	return err != nil || n <= reportRateLimit
+}
+
+func reportReasonKeyboard(ctx context.Context, chatID int64) tgbotapi.InlineKeyboardMarkup {
+	id := strconv.FormatInt(chatID, 10)
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for _, r := range ReportReasons {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(ReportReasonTexts[r]["zh"], newCallbackData(CallbackReport, id, r)),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// sendReportReasons asks the user why the group is reported
+func sendReportReasons(ctx context.Context, chatID int64, g GroupRecord) {
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(getLocalizedText(ctx, ReportReasonChoosing), g.Title))
+	msg.ReplyMarkup = reportReasonKeyboard(ctx, g.ChatID)
+	if _, err := botSend(ctx, msg); err != nil {
+		logger(ctx).Error().Err(err).Msg("send report reasons")
+	}
+}
+
+// hideReportedGroup takes the group out of search and queues it for the bot admins to review
+func hideReportedGroup(ctx context.Context, chatID int64, reports int) {
+	g, found := getGroup(ctx, chatID)
+	if !found || (g.Status != "" && g.Status != GroupStatusApproved) {
+		// already hidden
+		return
+	}
+
+	logger(ctx).Info().Int64("group_id", chatID).Int("reports", reports).Msg("group reported, hidden until reviewed")
+	g.Status = GroupStatusPending
+	writeGroup(ctx, g)
+	ddbEnqueueModeration(ctx, ModerationRecord{
+		ChatID:    chatID,
+		Group:     g,
+		Reason:    ModerationReasonReported,
+		CreatedAt: time.Now().Unix(),
+	})
+}
+
+func reportCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	chatID := getChatIDFromUpdate(update)
+	message := getChatMessageFromUpdate(update)
+
+	if s.Stage == CommandReceived {
+		if update.Message == nil || strings.TrimSpace(update.Message.CommandArguments()) == "" {
+			s.Stage = ReportLinkReceived
+			writeState(s)
+			sendText(ctx, chatID, getLocalizedText(ctx, InputGroupLink))
+			return
+		}
+		// the group is given along with the command, e.g. /report nightyworld
+		message = update.Message.CommandArguments()
+	}
+
+	groupUsername := getCheckGroupUsername(strings.TrimSpace(message))
+	if groupUsername == "" {
+		s.Stage = ReportLinkReceived
+		writeState(s)
+		sendText(ctx, chatID, getLocalizedText(ctx, UsernameInvalid))
+		return
+	}
+	clearState(s.ChatID)
+
+	g, found := opensearchFindGroupByUsername(ctx, groupUsername)
+	if !found {
+		sendText(ctx, chatID, getLocalizedText(ctx, GroupNotIndexed))
+		return
+	}
+	sendReportReasons(ctx, chatID, g)
+}
+
+// reportCallbackHandler handles the report buttons, args are the group chat ID and optionally the reason
+func reportCallbackHandler(ctx context.Context, update *tgbotapi.Update, args []string) {
+	query := update.CallbackQuery
+	if len(args) < 1 || query.Message == nil {
+		answerCallback(ctx, update, "")
+		return
+	}
+	chatID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		answerCallback(ctx, update, "")
+		return
+	}
+
+	// no reason yet, ask for it
+	if len(args) < 2 {
+		if g, found := getGroup(ctx, chatID); found {
+			sendReportReasons(ctx, query.Message.Chat.ID, g)
+		}
+		answerCallback(ctx, update, "")
+		return
+	}
+
+	if !reportAllowed(query.From.ID) {
+		answerCallback(ctx, update, getLocalizedText(ctx, ReportTooFrequent))
+		return
+	}
+
+	added := ddbWriteReport(ctx, ReportRecord{
+		ChatID:     chatID,
+		ReporterID: query.From.ID,
+		Reason:     args[1],
+		CreatedAt:  time.Now().Unix(),
+	})
+	if !added {
+		answerCallback(ctx, update, getLocalizedText(ctx, AlreadyReported))
+		return
+	}
+
+	if reports := ddbCountReports(ctx, chatID); reports >= reportHideThreshold {
+		hideReportedGroup(ctx, chatID, reports)
+	}
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, getLocalizedText(ctx, ReportReceived))
+	if _, err := botSend(ctx, edit); err != nil {
+		logger(ctx).Error().Err(err).Msg("edit report received")
+	}
+	answerCallback(ctx, update, "")
+}
+
+func init() {
+	if v, err := strconv.Atoi(os.Getenv("REPORT_HIDE_THRESHOLD")); err == nil && v > 0 {
+		reportHideThreshold = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("REPORT_RATE_LIMIT")); err == nil && v > 0 {
+		reportRateLimit = v
+	}
+}
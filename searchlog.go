@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// where a search log record comes from, besides the rank modes
+const (
+	SearchSourceSearch   = "search"
+	SearchSourceCategory = "category"
+)
+
+const (
+	searchLogDayFormat     = "20060102"
+	searchLogDefaultDays   = 7
+	searchLogMaxDays       = 30
+	searchLogExportQueries = 20
+)
+
+// search log records expire after this, configured by SEARCH_LOG_RETENTION_DAYS
+var searchLogRetention = 30 * 24 * time.Hour
+
+// normalizeQuery lowercases, de-duplicates and sorts the keywords, so the same query counts as one however it's typed
+func normalizeQuery(keywords []string) string {
+	dedup := map[string]bool{}
+	normalized := []string{}
+	for _, k := range keywords {
+		k = strings.ToLower(k)
+		if !dedup[k] {
+			dedup[k] = true
+			normalized = append(normalized, k)
+		}
+	}
+	sort.Strings(normalized)
+	return strings.Join(normalized, " ")
+}
+
+// newSearchLogID makes a short ID led by the day, so a click can find the record by the ID alone
+func newSearchLogID(now time.Time) string {
+	now = now.UTC()
+	return now.Format(searchLogDayFormat) + "." + strconv.FormatInt(now.UnixNano(), 36)
+}
+
+// logSearch records a search, or a page of the browsed groups, and returns the record ID to track the clicks
+func logSearch(ctx context.Context, source string, keywords []string, filters string, page, results int) string {
+	now := time.Now()
+	r := SearchLogRecord{
+		Day:       now.UTC().Format(searchLogDayFormat),
+		ID:        newSearchLogID(now),
+		Source:    source,
+		Query:     normalizeQuery(keywords),
+		Filters:   filters,
+		Page:      page,
+		Results:   results,
+		CreatedAt: now.Unix(),
+		ExpireAt:  now.Add(searchLogRetention).Unix(),
+	}
+	ddbWriteSearchLog(ctx, r)
+	return r.ID
+}
+
+// logSearchClick records a click on a result of the logged search
+func logSearchClick(ctx context.Context, id string, chatID int64) {
+	if len(id) <= len(searchLogDayFormat) {
+		return
+	}
+	ddbAddSearchClick(ctx, id[:len(searchLogDayFormat)], id, chatID)
+}
+
+// queryStat is the aggregation of the same query
+type queryStat struct {
+	Query       string
+	Count       int
+	ZeroResults int
+	Clicks      int
+}
+
+// aggregateQueries aggregates the keyword searches by query, returns the most frequent queries
+// and the most frequent ones without any result
+func aggregateQueries(records []SearchLogRecord, limit int) ([]queryStat, []queryStat) {
+	byQuery := map[string]*queryStat{}
+	for _, r := range records {
+		if r.Source != SearchSourceSearch || r.Query == "" {
+			continue
+		}
+		s, ok := byQuery[r.Query]
+		if !ok {
+			s = &queryStat{Query: r.Query}
+			byQuery[r.Query] = s
+		}
+		s.Count++
+		s.Clicks += len(r.Clicks)
+		if r.Results == 0 {
+			s.ZeroResults++
+		}
+	}
+
+	frequent, zero := []queryStat{}, []queryStat{}
+	for _, s := range byQuery {
+		frequent = append(frequent, *s)
+		if s.ZeroResults > 0 {
+			zero = append(zero, *s)
+		}
+	}
+	sort.Slice(frequent, func(i, j int) bool {
+		if frequent[i].Count != frequent[j].Count {
+			return frequent[i].Count > frequent[j].Count
+		}
+		return frequent[i].Query < frequent[j].Query
+	})
+	sort.Slice(zero, func(i, j int) bool {
+		if zero[i].ZeroResults != zero[j].ZeroResults {
+			return zero[i].ZeroResults > zero[j].ZeroResults
+		}
+		return zero[i].Query < zero[j].Query
+	})
+	if len(frequent) > limit {
+		frequent = frequent[:limit]
+	}
+	if len(zero) > limit {
+		zero = zero[:limit]
+	}
+	return frequent, zero
+}
+
+func formatQueryStats(ctx context.Context, days int, frequent, zero []queryStat) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>%s</b>\n", fmt.Sprintf(getLocalizedText(ctx, SearchLogFrequent), days))
+	for i, s := range frequent {
+		fmt.Fprintf(&b, "%d. %s  ×%d, clicks %d\n", i+1, html.EscapeString(s.Query), s.Count, s.Clicks)
+	}
+	fmt.Fprintf(&b, "\n<b>%s</b>\n", fmt.Sprintf(getLocalizedText(ctx, SearchLogZeroResult), days))
+	for i, s := range zero {
+		fmt.Fprintf(&b, "%d. %s  ×%d\n", i+1, html.EscapeString(s.Query), s.ZeroResults)
+	}
+	return b.String()
+}
+
+// searchLogCommandHandler handles /searchlog [days] for the bot admins, it lists the most frequent
+// and the zero-result queries of the recent days
+func searchLogCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	defer clearState(s.ChatID)
+
+	if update.Message == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+
+	if !isBotAdmin(update.Message.From.ID) {
+		sendText(ctx, chatID, getLocalizedText(ctx, PermissionDenied))
+		return
+	}
+
+	days := searchLogDefaultDays
+	if arg := strings.TrimSpace(update.Message.CommandArguments()); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 || n > searchLogMaxDays {
+			sendText(ctx, chatID, fmt.Sprintf(getLocalizedText(ctx, SearchLogUsage), searchLogMaxDays))
+			return
+		}
+		days = n
+	}
+
+	now := time.Now().UTC()
+	records := []SearchLogRecord{}
+	for i := 0; i < days; i++ {
+		records = append(records, ddbGetSearchLog(ctx, now.AddDate(0, 0, -i).Format(searchLogDayFormat))...)
+	}
+
+	frequent, zero := aggregateQueries(records, searchLogExportQueries)
+	msg := tgbotapi.NewMessage(chatID, formatQueryStats(ctx, days, frequent, zero))
+	msg.ParseMode = tgbotapi.ModeHTML
+	queueMessage(ctx, msg)
+}
+
+func init() {
+	if v, err := strconv.Atoi(os.Getenv("SEARCH_LOG_RETENTION_DAYS")); err == nil && v > 0 {
+		searchLogRetention = time.Duration(v) * 24 * time.Hour
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	if got := normalizeQuery([]string{"Golang", "编程", "golang"}); got != "golang 编程" {
+		t.Errorf("normalizeQuery() = %q", got)
+	}
+	if got := normalizeQuery(nil); got != "" {
+		t.Errorf("normalizeQuery(nil) = %q", got)
+	}
+}
+
+func TestNewSearchLogID(t *testing.T) {
+	id := newSearchLogID(time.Date(2021, 11, 20, 23, 0, 0, 0, time.FixedZone("UTC-2", -2*3600)))
+	if !strings.HasPrefix(id, "20211121.") {
+		t.Errorf("ID should lead by the UTC day, got %s", id)
+	}
+}
+
+func TestAggregateQueries(t *testing.T) {
+	records := []SearchLogRecord{
+		{Source: SearchSourceSearch, Query: "golang", Results: 5, Clicks: []int64{-1, -2}},
+		{Source: SearchSourceSearch, Query: "golang", Results: 5},
+		{Source: SearchSourceSearch, Query: "rust", Results: 0},
+		{Source: SearchSourceSearch, Query: "zig", Results: 0},
+		{Source: SearchSourceSearch, Query: "zig", Results: 0},
+		{Source: SearchSourceSearch, Query: "", Results: 0},
+		{Source: RankTop, Filters: "channel", Results: 10},
+	}
+
+	frequent, zero := aggregateQueries(records, 2)
+	if len(frequent) != 2 || frequent[0].Query != "golang" || frequent[0].Count != 2 || frequent[0].Clicks != 2 || frequent[1].Query != "zig" {
+		t.Errorf("unexpected frequent queries: %+v", frequent)
+	}
+	if len(zero) != 2 || zero[0].Query != "zig" || zero[0].ZeroResults != 2 || zero[1].Query != "rust" {
+		t.Errorf("unexpected zero-result queries: %+v", zero)
+	}
+}
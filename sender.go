@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	sendQueueSize      = 1000
+	sendEnqueueTimeout = time.Second // how long queueing a message waits for room before dropping it
+	sendMaxAttempts    = 5
+	sendBaseBackoff    = 500 * time.Millisecond
+	sendMaxBackoff     = 30 * time.Second
+)
+
+// what to do with a message after a delivery attempt
+const (
+	sendDone          = iota
+	sendRetry         // transient error, try again later
+	sendGiveUp        // permanent error, e.g. malformed message
+	sendRecipientGone // the user blocked the bot or is deactivated, or the bot is out of the group
+)
+
+type outgoingMessage struct {
+	ctx    context.Context // the values, e.g. the update's logger, are kept for the delivery
+	chatID int64
+	c      tgbotapi.Chattable
+}
+
+// sendQueue delivers the outgoing messages in order by a single worker. A message failed transiently is
+// retried by a goroutine of its chat, which takes over the chat's later messages until its backlog is
+// delivered, so the other chats aren't held up by the retries.
+type sendQueue struct {
+	ch chan outgoingMessage
+	wg sync.WaitGroup
+
+	open    sync.RWMutex // held for reading while queueing, so the queue isn't closed under a sender
+	running bool
+
+	mu      sync.Mutex
+	delayed map[int64][]outgoingMessage // the backlog of the chats being retried
+}
+
+var sender = newSendQueue(sendQueueSize)
+
+func newSendQueue(size int) *sendQueue {
+	return &sendQueue{ch: make(chan outgoingMessage, size), delayed: map[int64][]outgoingMessage{}}
+}
+
+// start runs the worker until the queue is closed
+func (q *sendQueue) start(ctx context.Context) {
+	q.open.Lock()
+	q.running = true
+	q.open.Unlock()
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for m := range q.ch {
+			q.dispatch(ctx, m)
+		}
+	}()
+}
+
+// close waits for the queued messages to be delivered, the messages sent afterwards are delivered synchronously
+func (q *sendQueue) close() {
+	q.open.Lock()
+	q.running = false
+	q.open.Unlock()
+
+	close(q.ch)
+	q.wg.Wait()
+}
+
+// enqueue queues the message, or delivers it synchronously if the queue isn't running. The message is
+// dropped if the queue stays full, rather than blocking the update handling.
+func (q *sendQueue) enqueue(m outgoingMessage) {
+	q.open.RLock()
+	defer q.open.RUnlock()
+
+	if !q.running {
+		deliverMessage(m.ctx, m.chatID, m.c)
+		return
+	}
+
+	timer := time.NewTimer(sendEnqueueTimeout)
+	defer timer.Stop()
+	select {
+	case q.ch <- m:
+	case <-timer.C:
+		logger(m.ctx).Error().Int64("target_chat_id", m.chatID).Msg("send: queue full, message dropped")
+	}
+}
+
+// dispatch makes the first delivery attempt of the message, unless its chat is being retried
+func (q *sendQueue) dispatch(ctx context.Context, m outgoingMessage) {
+	q.mu.Lock()
+	if backlog, ok := q.delayed[m.chatID]; ok {
+		q.delayed[m.chatID] = append(backlog, m)
+		q.mu.Unlock()
+		return
+	}
+	q.mu.Unlock()
+
+	// the delivery outlives the handling of the update, it's only cancelled with the worker
+	outcome, wait, _ := attemptMessage(valuesContext{Context: ctx, values: m.ctx}, m.chatID, m.c, 0)
+	if outcome != sendRetry {
+		return
+	}
+
+	q.mu.Lock()
+	q.delayed[m.chatID] = []outgoingMessage{}
+	q.mu.Unlock()
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		q.retry(ctx, m, wait)
+	}()
+}
+
+// retry redelivers the message, then the chat's backlog in order before handing the chat back to the worker
+func (q *sendQueue) retry(ctx context.Context, m outgoingMessage, wait time.Duration) {
+	redeliverMessage(valuesContext{Context: ctx, values: m.ctx}, m.chatID, m.c, 1, wait)
+	for {
+		q.mu.Lock()
+		backlog := q.delayed[m.chatID]
+		if len(backlog) == 0 {
+			delete(q.delayed, m.chatID)
+			q.mu.Unlock()
+			return
+		}
+		next := backlog[0]
+		q.delayed[m.chatID] = backlog[1:]
+		q.mu.Unlock()
+
+		deliverMessage(valuesContext{Context: ctx, values: next.ctx}, next.chatID, next.c)
+	}
+}
+
+// deliverMessage sends the message to the chat, retrying the transient failures,
+// it returns the final outcome along with the last error
+func deliverMessage(ctx context.Context, chatID int64, c tgbotapi.Chattable) (int, error) {
+	outcome, wait, err := attemptMessage(ctx, chatID, c, 0)
+	if outcome != sendRetry {
+		return outcome, err
+	}
+	return redeliverMessage(ctx, chatID, c, 1, wait)
+}
+
+// redeliverMessage retries the message after the wait, attempt is the number of the attempts made so far
+func redeliverMessage(ctx context.Context, chatID int64, c tgbotapi.Chattable, attempt int, wait time.Duration) (int, error) {
+	for ; ; attempt++ {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return sendGiveUp, ctx.Err()
+		}
+
+		outcome, next, err := attemptMessage(ctx, chatID, c, attempt)
+		if outcome != sendRetry {
+			return outcome, err
+		}
+		wait = next
+	}
+}
+
+// attemptMessage makes one delivery attempt, the final outcomes are logged and dealt with here.
+// On sendRetry it tells how long to wait before the next attempt.
+func attemptMessage(ctx context.Context, chatID int64, c tgbotapi.Chattable, attempt int) (int, time.Duration, error) {
+	_, err := botRequest(ctx, c)
+	outcome, wait := classifySendError(err)
+	switch outcome {
+	case sendDone:
+		return outcome, 0, nil
+	case sendRecipientGone:
+		logger(ctx).Warn().Err(err).Int64("target_chat_id", chatID).Msg("send: recipient gone")
+		// positive chat IDs are users
+		if chatID > 0 {
+			ddbMarkUserInactive(ctx, chatID)
+		}
+		return outcome, 0, err
+	case sendGiveUp:
+		logger(ctx).Error().Err(err).Int64("target_chat_id", chatID).Msg("send: give up")
+		return outcome, 0, err
+	}
+
+	if attempt+1 >= sendMaxAttempts {
+		logger(ctx).Error().Err(err).Int64("target_chat_id", chatID).Int("attempts", attempt+1).Msg("send: give up")
+		return sendGiveUp, 0, err
+	}
+	if wait == 0 {
+		wait = sendBackoff(attempt)
+	}
+	logger(ctx).Warn().Err(err).Int64("target_chat_id", chatID).Dur("retry_in", wait).Msg("send: retry")
+	return sendRetry, wait, err
+}
+
+// classifySendError tells what to do with the message after the error, along with how long
+// telegram asks us to wait before retrying, 0 if it doesn't
+func classifySendError(err error) (int, time.Duration) {
+	if err == nil {
+		return sendDone, 0
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return sendGiveUp, 0
+	}
+
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		// network errors and garbled responses of a struggling server
+		return sendRetry, 0
+	}
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests || apiErr.RetryAfter > 0:
+		return sendRetry, time.Duration(apiErr.RetryAfter) * time.Second
+	case apiErr.Code >= http.StatusInternalServerError:
+		return sendRetry, 0
+	case apiErr.Code == http.StatusForbidden:
+		return sendRecipientGone, 0
+	default:
+		return sendGiveUp, 0
+	}
+}
+
+// sendBackoff grows exponentially with the attempts, jittered to spread out the retries
+func sendBackoff(attempt int) time.Duration {
+	d := sendBaseBackoff << attempt
+	if d <= 0 || d > sendMaxBackoff {
+		d = sendMaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// queueMessage sends the message in the background, the failures are retried or logged by the queue.
+// Under a request the message is sent before the request is answered instead, in order with the others.
+func queueMessage(ctx context.Context, msg tgbotapi.MessageConfig) {
+	if inRequest(ctx) {
+		deliverMessage(ctx, msg.ChatID, msg)
+		return
+	}
+	sender.enqueue(outgoingMessage{ctx: ctx, chatID: msg.ChatID, c: msg})
+}
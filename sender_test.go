@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestClassifySendError(t *testing.T) {
+	cases := []struct {
+		err     error
+		outcome int
+		wait    time.Duration
+	}{
+		{nil, sendDone, 0},
+		{&tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}}, sendRetry, 7 * time.Second},
+		{&tgbotapi.Error{Code: 502, Message: "Bad Gateway"}, sendRetry, 0},
+		{&tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, sendRecipientGone, 0},
+		{&tgbotapi.Error{Code: 400, Message: "Bad Request: message text is empty"}, sendGiveUp, 0},
+		{errors.New("connection reset by peer"), sendRetry, 0},
+		{fmt.Errorf("post: %w", context.DeadlineExceeded), sendGiveUp, 0},
+	}
+	for _, c := range cases {
+		outcome, wait := classifySendError(c.err)
+		if outcome != c.outcome || wait != c.wait {
+			t.Errorf("classifySendError(%v) = %d, %v, want %d, %v", c.err, outcome, wait, c.outcome, c.wait)
+		}
+	}
+}
+
+func TestSendBackoff(t *testing.T) {
+	for attempt := 0; attempt < 100; attempt++ {
+		d := sendBackoff(attempt)
+		if d <= 0 || d > sendMaxBackoff {
+			t.Fatalf("backoff of attempt %d out of range: %v", attempt, d)
+		}
+	}
+	if d := sendBackoff(0); d < sendBaseBackoff/2 || d >= sendBaseBackoff {
+		t.Fatalf("first backoff should be jittered within [%v, %v), got %v", sendBaseBackoff/2, sendBaseBackoff, d)
+	}
+}
+
+// newFlakyTelegram serves sendMessage, failing the first attempt to the flaky chat with a 502,
+// and records the texts delivered in order
+func newFlakyTelegram(t *testing.T, flaky string) *[]string {
+	var (
+		mu        sync.Mutex
+		delivered []string
+		failed    bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		rsp := tgbotapi.APIResponse{Ok: true, Result: json.RawMessage(`{"message_id":1,"date":0,"chat":{"id":1}}`)}
+		mu.Lock()
+		switch {
+		case r.PostForm.Get("chat_id") == flaky && !failed:
+			failed = true
+			rsp = tgbotapi.APIResponse{Ok: false, ErrorCode: http.StatusBadGateway, Description: "Bad Gateway"}
+		case r.PostForm.Get("text") != "":
+			delivered = append(delivered, r.PostForm.Get("text"))
+		default:
+			rsp.Result = json.RawMessage(`{"id":1,"is_bot":true,"first_name":"bot","username":"bot"}`)
+		}
+		mu.Unlock()
+		json.NewEncoder(w).Encode(rsp)
+	}))
+	t.Cleanup(server.Close)
+
+	b, err := tgbotapi.NewBotAPIWithAPIEndpoint("test", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := bot
+	bot = b
+	t.Cleanup(func() { bot = old })
+	return &delivered
+}
+
+func TestSendQueueRetriesOffTheWorker(t *testing.T) {
+	delivered := newFlakyTelegram(t, "1")
+
+	q := newSendQueue(10)
+	q.start(context.Background())
+	ctx := context.Background()
+	q.enqueue(outgoingMessage{ctx: ctx, chatID: 1, c: tgbotapi.NewMessage(1, "a1")})
+	q.enqueue(outgoingMessage{ctx: ctx, chatID: 2, c: tgbotapi.NewMessage(2, "b1")})
+	q.enqueue(outgoingMessage{ctx: ctx, chatID: 1, c: tgbotapi.NewMessage(1, "a2")})
+	q.enqueue(outgoingMessage{ctx: ctx, chatID: 2, c: tgbotapi.NewMessage(2, "b2")})
+	q.close()
+
+	// the other chat isn't held up by the retry, the retried chat keeps its order
+	want := []string{"b1", "b2", "a1", "a2"}
+	if fmt.Sprint(*delivered) != fmt.Sprint(want) {
+		t.Errorf("got delivered %v, want %v", *delivered, want)
+	}
+}
+
+func TestSendQueueNotRunning(t *testing.T) {
+	delivered := newFlakyTelegram(t, "none")
+
+	// never started, the message is delivered synchronously rather than blocking forever
+	q := newSendQueue(0)
+	q.enqueue(outgoingMessage{ctx: context.Background(), chatID: 1, c: tgbotapi.NewMessage(1, "hello")})
+	if len(*delivered) != 1 {
+		t.Errorf("got delivered %v, want the message", *delivered)
+	}
+}
+
+func TestQueueMessageInRequest(t *testing.T) {
+	delivered := newFlakyTelegram(t, "none")
+
+	old := sender
+	sender = newSendQueue(10)
+	sender.start(context.Background())
+	defer func() {
+		sender.close()
+		sender = old
+	}()
+
+	// answering the request may freeze the process, so the reply is sent before returning
+	queueMessage(withRequest(context.Background()), tgbotapi.NewMessage(1, "reply"))
+	if len(*delivered) != 1 {
+		t.Errorf("got delivered %v, want the reply", *delivered)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	similarKey      = "similar:"
+	similarCacheTTL = time.Hour
+	similarSize     = 10
+)
+
+// getSimilarGroups finds the groups like g, leaving out g itself and the blocklisted ones
+func getSimilarGroups(ctx context.Context, g GroupRecord) []GroupRecord {
+	key := similarKey + strconv.FormatInt(g.ChatID, 10)
+	if x, found := mcache.Get(key); found {
+		return x.([]GroupRecord)
+	}
+
+	// fetch a few more since some may be filtered out
+	similar := []GroupRecord{}
+	for _, s := range opensearchSimilarGroups(ctx, g, similarSize+5) {
+		if s.ChatID == g.ChatID {
+			continue
+		}
+		if _, blocked := checkBlocklist(ctx, s); blocked {
+			continue
+		}
+		similar = append(similar, s)
+		if len(similar) == similarSize {
+			break
+		}
+	}
+
+	mcache.Set(key, similar, similarCacheTTL)
+	return similar
+}
+
+// similarCallbackHandler lists the groups similar to the one in the detail view, args is the group chat ID
+func similarCallbackHandler(ctx context.Context, update *tgbotapi.Update, args []string) {
+	defer answerCallback(ctx, update, "")
+
+	query := update.CallbackQuery
+	if len(args) < 1 || query.Message == nil {
+		return
+	}
+	groupID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return
+	}
+	chatID := query.Message.Chat.ID
+
+	g, found := getGroup(ctx, groupID)
+	if !found {
+		sendText(ctx, chatID, getLocalizedText(ctx, GroupNotIndexed))
+		return
+	}
+
+	similar := getSimilarGroups(ctx, g)
+	if len(similar) == 0 {
+		sendText(ctx, chatID, getLocalizedText(ctx, NoSimilarGroup))
+		return
+	}
+
+	content := fmt.Sprintf(getLocalizedText(ctx, SimilarGroups), html.EscapeString(g.Title)) + "\n\n" + formatGroupList(similar, 0)
+	msg := tgbotapi.NewMessage(chatID, content)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.DisableWebPagePreview = true
+	if keyboard := resultKeyboard(similar, 0, ""); keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	if _, err := botSend(ctx, msg); err != nil {
+		logger(ctx).Error().Err(err).Msg("send similar groups")
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"log"
 	"strconv"
 	"time"
 
@@ -23,7 +22,7 @@ func getState(ctx context.Context, chatID int64) *CommandState {
 
 	if x, found := mcache.Get(key); found {
 		state := x.(*CommandState)
-		log.Printf("getState, chatID: %v, command: %v, stage: %v\n", state.ChatID, state.Command, state.Stage)
+		logger(ctx).Debug().Str("state_command", state.Command).Str("stage", state.Stage).Msg("get state")
 		return state
 	}
 
@@ -32,12 +31,12 @@ func getState(ctx context.Context, chatID int64) *CommandState {
 
 func writeState(state *CommandState) {
 	key := stateKey + strconv.FormatInt(state.ChatID, 10)
-	log.Printf("writeState, chatID: %v, command: %v, stage: %v\n", state.ChatID, state.Command, state.Stage)
+	baseLogger.Debug().Int64("state_chat_id", state.ChatID).Str("state_command", state.Command).Str("stage", state.Stage).Msg("write state")
 	mcache.Set(key, state, cache.DefaultExpiration)
 }
 
 func clearState(chatID int64) {
 	key := stateKey + strconv.FormatInt(chatID, 10)
-	log.Printf("clearState, chatID: %v\n", key)
+	baseLogger.Debug().Int64("state_chat_id", chatID).Msg("clear state")
 	mcache.Delete(key)
 }
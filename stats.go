@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// usage metrics, counted per day in UTC
+const (
+	StatActiveUsers        = "active_users"
+	StatSearches           = "searches"
+	StatZeroResultSearches = "zero_result_searches"
+	StatAddAttempts        = "add_attempts"
+	StatAddSuccesses       = "add_successes"     // indexed right away
+	StatAddPending         = "add_pending"       // held for review
+	StatIndexedType        = "indexed_type:"     // followed by the group type
+	StatIndexedCategory    = "indexed_category:" // followed by the category, counted once the group is categorized
+)
+
+const (
+	statsDayFormat   = "20060102"
+	statsRetention   = 400 * 24 * time.Hour // stats rows expire after this
+	dailyUserTTL     = 48 * time.Hour       // the daily active users are only needed to count them
+	statsCompareDays = 7
+)
+
+var (
+	statsFlushInterval = time.Minute
+
+	stats = newStatsTracker()
+)
+
+type statsKey struct {
+	day    string
+	metric string
+}
+
+// statsTracker aggregates the counters in memory until flushed
+type statsTracker struct {
+	mu       sync.Mutex
+	counters map[statsKey]int
+	users    map[statsKey]bool // the users seen active, metric is the user ID
+	seen     map[statsKey]bool // the users flushed already, reset along with the day
+	seenDay  string
+}
+
+func newStatsTracker() *statsTracker {
+	return &statsTracker{
+		counters: map[statsKey]int{},
+		users:    map[statsKey]bool{},
+		seen:     map[statsKey]bool{},
+	}
+}
+
+func (t *statsTracker) add(metric string, n int, at time.Time) {
+	key := statsKey{day: at.UTC().Format(statsDayFormat), metric: metric}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.counters[key] += n
+}
+
+func (t *statsTracker) trackUser(userID int64, at time.Time) {
+	key := statsKey{day: at.UTC().Format(statsDayFormat), metric: strconv.FormatInt(userID, 10)}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.seen[key] {
+		t.users[key] = true
+	}
+}
+
+// take hands over the aggregated counters and the users not flushed yet today, and starts a new aggregation
+func (t *statsTracker) take(now time.Time) (map[statsKey]int, map[statsKey]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if day := now.UTC().Format(statsDayFormat); day != t.seenDay {
+		t.seen = map[statsKey]bool{}
+		t.seenDay = day
+	}
+	for key := range t.users {
+		t.seen[key] = true
+	}
+
+	counters, users := t.counters, t.users
+	t.counters, t.users = map[statsKey]int{}, map[statsKey]bool{}
+	return counters, users
+}
+
+func (t *statsTracker) flush(ctx context.Context) {
+	counters, users := t.take(time.Now())
+
+	// a user only counts once a day however many processes see the user
+	for key := range users {
+		userID, _ := strconv.ParseInt(key.metric, 10, 64)
+		if ddbMarkDailyUser(ctx, key.day, userID, time.Now().Add(dailyUserTTL).Unix()) {
+			counters[statsKey{day: key.day, metric: StatActiveUsers}]++
+		}
+	}
+
+	expireAt := time.Now().Add(statsRetention).Unix()
+	for key, n := range counters {
+		ddbAddStat(ctx, StatRecord{Day: key.day, Metric: key.metric, Count: n, ExpireAt: expireAt})
+	}
+}
+
+// countStat counts n for the metric today
+func countStat(metric string, n int) {
+	stats.add(metric, n, time.Now())
+}
+
+// trackActiveUser counts the user as active today
+func trackActiveUser(userID int64) {
+	stats.trackUser(userID, time.Now())
+}
+
+// countIndexedGroup counts a newly indexed group by its type, and by its category if it comes categorized
+func countIndexedGroup(g GroupRecord) {
+	countStat(StatIndexedType+g.Type, 1)
+	if g.Category != "" {
+		countCategorizedGroup(g.Category)
+	}
+}
+
+// countCategorizedGroup counts a group given its first category
+func countCategorizedGroup(category string) {
+	countStat(StatIndexedCategory+category, 1)
+}
+
+// startStatsFlusher flushes the counters to dynamodb periodically until ctx is done
+func startStatsFlusher(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(statsFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				stats.flush(ctx)
+			case <-ctx.Done():
+				stats.flush(context.Background())
+				return
+			}
+		}
+	}()
+}
+
+// dailyStats are the counters of the days, latest first
+type dailyStats []map[string]int
+
+// sum adds up the metric over the days in [from, to)
+func (s dailyStats) sum(metric string, from, to int) int {
+	total := 0
+	for i := from; i < to && i < len(s); i++ {
+		total += s[i][metric]
+	}
+	return total
+}
+
+// metrics lists the metrics of the prefix found in any day, sorted
+func (s dailyStats) metrics(prefix string) []string {
+	dedup := map[string]bool{}
+	for _, day := range s {
+		for m := range day {
+			if strings.HasPrefix(m, prefix) {
+				dedup[m] = true
+			}
+		}
+	}
+	metrics := []string{}
+	for m := range dedup {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+	return metrics
+}
+
+// formatChange renders the change from prev to cur in percentage
+func formatChange(cur, prev int) string {
+	if prev == 0 {
+		if cur == 0 {
+			return "0%"
+		}
+		return "new"
+	}
+	return fmt.Sprintf("%+d%%", (cur-prev)*100/prev)
+}
+
+// getDailyStats gets the counters of the recent days, today first
+func getDailyStats(ctx context.Context, days int) dailyStats {
+	now := time.Now().UTC()
+	s := make(dailyStats, 0, days)
+	for i := 0; i < days; i++ {
+		counters := map[string]int{}
+		for _, r := range ddbGetStats(ctx, now.AddDate(0, 0, -i).Format(statsDayFormat)) {
+			counters[r.Metric] = r.Count
+		}
+		s = append(s, counters)
+	}
+	return s
+}
+
+// formatStats renders the metrics today vs yesterday and of the last 7 days vs the 7 days before
+func formatStats(ctx context.Context, s dailyStats, title string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>%s</b>\n<pre>", html.EscapeString(title))
+	fmt.Fprintf(&b, "%-22s %7s %7s %6s %7s %7s %6s\n", "", "today", "yday", "Δ", "7d", "prev7d", "Δ")
+
+	row := func(name, metric string, average bool) {
+		today, yesterday := s.sum(metric, 0, 1), s.sum(metric, 1, 2)
+		week, prevWeek := s.sum(metric, 0, statsCompareDays), s.sum(metric, statsCompareDays, 2*statsCompareDays)
+		// a user active on several days isn't a different user, so the week shows the daily average
+		if average {
+			week, prevWeek = week/statsCompareDays, prevWeek/statsCompareDays
+		}
+		fmt.Fprintf(&b, "%-22s %7d %7d %6s %7d %7d %6s\n", html.EscapeString(name), today, yesterday, formatChange(today, yesterday), week, prevWeek, formatChange(week, prevWeek))
+	}
+	row("active users (avg)", StatActiveUsers, true)
+	row("searches", StatSearches, false)
+	row("zero result searches", StatZeroResultSearches, false)
+	row("add attempts", StatAddAttempts, false)
+	row("add successes", StatAddSuccesses, false)
+	row("add pending", StatAddPending, false)
+	for _, m := range s.metrics(StatIndexedType) {
+		row("type "+strings.TrimPrefix(m, StatIndexedType), m, false)
+	}
+	for _, m := range s.metrics(StatIndexedCategory) {
+		row("cat. "+strings.TrimPrefix(m, StatIndexedCategory), m, false)
+	}
+	b.WriteString("</pre>")
+	return b.String()
+}
+
+// statsCommandHandler handles /stats for the bot admins
+func statsCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	defer clearState(s.ChatID)
+
+	if update.Message == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+
+	if !isBotAdmin(update.Message.From.ID) {
+		sendText(ctx, chatID, getLocalizedText(ctx, PermissionDenied))
+		return
+	}
+
+	// the counters not flushed yet count too
+	stats.flush(ctx)
+
+	msg := tgbotapi.NewMessage(chatID, formatStats(ctx, getDailyStats(ctx, 2*statsCompareDays), getLocalizedText(ctx, StatsTitle)))
+	msg.ParseMode = tgbotapi.ModeHTML
+	queueMessage(ctx, msg)
+}
+
+func init() {
+	if v, err := strconv.Atoi(os.Getenv("STATS_FLUSH_SECONDS")); err == nil && v > 0 {
+		statsFlushInterval = time.Duration(v) * time.Second
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsTracker(t *testing.T) {
+	tracker := newStatsTracker()
+	now := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+
+	tracker.add(StatSearches, 1, now)
+	tracker.add(StatSearches, 2, now)
+	tracker.trackUser(1, now)
+	tracker.trackUser(1, now)
+
+	counters, users := tracker.take(now)
+	if counters[statsKey{day: "20211120", metric: StatSearches}] != 3 {
+		t.Fatalf("unexpected counters: %v", counters)
+	}
+	if len(users) != 1 {
+		t.Fatalf("expect 1 user, got %v", users)
+	}
+
+	// a flushed user isn't taken again on the same day, but is on the next day
+	tracker.trackUser(1, now)
+	if _, users := tracker.take(now); len(users) != 0 {
+		t.Fatalf("user should be taken once a day, got %v", users)
+	}
+	tomorrow := now.Add(24 * time.Hour)
+	tracker.take(tomorrow)
+	tracker.trackUser(1, tomorrow)
+	if _, users := tracker.take(tomorrow); len(users) != 1 {
+		t.Fatalf("user should be taken again the next day, got %v", users)
+	}
+}
+
+func TestDailyStats(t *testing.T) {
+	s := dailyStats{
+		{StatSearches: 3, StatIndexedType + "channel": 1},
+		{StatSearches: 2, StatIndexedType + "supergroup": 2},
+		{StatSearches: 1},
+	}
+	if got := s.sum(StatSearches, 0, 2); got != 5 {
+		t.Errorf("sum of the first 2 days = %d, want 5", got)
+	}
+	if got := s.sum(StatSearches, 1, 10); got != 3 {
+		t.Errorf("sum beyond the days = %d, want 3", got)
+	}
+	want := []string{StatIndexedType + "channel", StatIndexedType + "supergroup"}
+	if got := s.metrics(StatIndexedType); !reflect.DeepEqual(got, want) {
+		t.Errorf("metrics = %v, want %v", got, want)
+	}
+}
+
+func TestFormatChange(t *testing.T) {
+	cases := []struct {
+		cur, prev int
+		want      string
+	}{
+		{0, 0, "0%"},
+		{5, 0, "new"},
+		{15, 10, "+50%"},
+		{5, 10, "-50%"},
+	}
+	for _, c := range cases {
+		if got := formatChange(c.cur, c.prev); got != c.want {
+			t.Errorf("formatChange(%d, %d) = %s, want %s", c.cur, c.prev, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	subscriptionsKey        = "subscriptions"
+	subscriptionsCacheTTL   = time.Minute
+	maxSubscriptionsPerUser = 10
+	maxSubscriptionKeywords = 3
+
+	alertRateKey      = "alert:"
+	alertDailyLimit   = 5                   // alert messages a user receives per day at most
+	alertMaxGroups    = 10                  // groups listed in one alert message
+	notifiedRetention = 90 * 24 * time.Hour // a user isn't alerted of the same group again within this
+)
+
+var (
+	alertFlushInterval = 5 * time.Minute
+
+	alerts = newAlertQueue()
+)
+
+// normalizeKeywords lowercases, de-duplicates and sorts the keywords, returns nil if any is invalid
+func normalizeKeywords(input string) []string {
+	dedup := map[string]bool{}
+	keywords := []string{}
+	for _, k := range strings.Fields(strings.ToLower(input)) {
+		if !patternGroupTag.MatchString(k) {
+			return nil
+		}
+		if !dedup[k] {
+			dedup[k] = true
+			keywords = append(keywords, k)
+		}
+	}
+	sort.Strings(keywords)
+	return keywords
+}
+
+// matchKeywords reports whether the group mentions all the keywords in its title or description
+func matchKeywords(keywords []string, g GroupRecord) bool {
+	if len(keywords) == 0 {
+		return false
+	}
+	text := strings.ToLower(g.Title + " " + g.Description)
+	for _, k := range keywords {
+		if !strings.Contains(text, k) {
+			return false
+		}
+	}
+	return true
+}
+
+// getSubscriptions returns all the subscriptions, cached for matching every indexed group in process
+func getSubscriptions(ctx context.Context) []SubscriptionRecord {
+	if x, found := mcache.Get(subscriptionsKey); found {
+		return x.([]SubscriptionRecord)
+	}
+	subs := ddbListSubscriptions(ctx)
+	mcache.Set(subscriptionsKey, subs, subscriptionsCacheTTL)
+	return subs
+}
+
+// alertQueue batches the matched groups per user until flushed
+type alertQueue struct {
+	mu      sync.Mutex
+	pending map[int64][]GroupRecord
+}
+
+func newAlertQueue() *alertQueue {
+	return &alertQueue{pending: map[int64][]GroupRecord{}}
+}
+
+func (q *alertQueue) add(userID int64, g GroupRecord) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, queued := range q.pending[userID] {
+		if queued.ChatID == g.ChatID {
+			return
+		}
+	}
+	q.pending[userID] = append(q.pending[userID], g)
+}
+
+func (q *alertQueue) take() map[int64][]GroupRecord {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := q.pending
+	q.pending = map[int64][]GroupRecord{}
+	return pending
+}
+
+// alertAllowed tells whether the user is still within the daily limit of alert messages
+func alertAllowed(userID int64) bool {
+	n, found := mcache.Get(alertRateKey + strconv.FormatInt(userID, 10))
+	return !found || n.(int) < alertDailyLimit
+}
+
+// countAlert counts an alert message delivered to the user against the daily limit
+func countAlert(userID int64) {
+	key := alertRateKey + strconv.FormatInt(userID, 10)
+	if err := mcache.Add(key, 1, 24*time.Hour); err != nil {
+		mcache.IncrementInt(key, 1)
+	}
+}
+
+// flush sends one alert message per user, listing the groups the user hasn't been alerted of. The groups
+// held back by the daily limit or failed to send are queued again for a later flush, only the delivered
+// ones are marked notified and count against the limit.
+func (q *alertQueue) flush(ctx context.Context) {
+	for userID, groups := range q.take() {
+		fresh := []GroupRecord{}
+		for _, g := range groups {
+			if !ddbNotified(ctx, userID, g.ChatID) {
+				fresh = append(fresh, g)
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		if !alertAllowed(userID) {
+			q.requeue(userID, fresh)
+			continue
+		}
+		if len(fresh) > alertMaxGroups {
+			q.requeue(userID, fresh[alertMaxGroups:])
+			fresh = fresh[:alertMaxGroups]
+		}
+
+		msg := tgbotapi.NewMessage(userID, getLocalizedText(ctx, SubscriptionAlert)+"\n\n"+formatGroupList(fresh, 0))
+		msg.ParseMode = tgbotapi.ModeHTML
+		msg.DisableWebPagePreview = true
+		// delivered by the flusher itself to learn the outcome
+		switch outcome, _ := deliverMessage(ctx, userID, msg); outcome {
+		case sendDone:
+		case sendRecipientGone:
+			// the user blocked the bot, no alert is going to reach them
+			continue
+		default:
+			q.requeue(userID, fresh)
+			continue
+		}
+		countAlert(userID)
+		expireAt := time.Now().Add(notifiedRetention).Unix()
+		for _, g := range fresh {
+			ddbMarkNotified(ctx, userID, g.ChatID, expireAt)
+		}
+	}
+}
+
+// requeue puts the groups back to alert the user of them by a later flush
+func (q *alertQueue) requeue(userID int64, groups []GroupRecord) {
+	for _, g := range groups {
+		q.add(userID, g)
+	}
+}
+
+// queueSubscriptionAlerts matches a searchable group against all the subscriptions
+func queueSubscriptionAlerts(ctx context.Context, g GroupRecord) {
+	for _, sub := range getSubscriptions(ctx) {
+		if matchKeywords(strings.Fields(sub.Keywords), g) {
+			alerts.add(sub.UserID, g)
+		}
+	}
+}
+
+// startAlertFlusher sends the queued alerts periodically until ctx is done
+func startAlertFlusher(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(alertFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				alerts.flush(ctx)
+			case <-ctx.Done():
+				alerts.flush(context.Background())
+				return
+			}
+		}
+	}()
+}
+
+func formatSubscriptions(subs []SubscriptionRecord) string {
+	content := ""
+	for i, sub := range subs {
+		content += fmt.Sprintf("%d. %s\n", i+1, sub.Keywords)
+	}
+	return content
+}
+
+// subscribeCommandHandler handles /subscribe, the keywords come along with the command or in the next message
+func subscribeCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	if update.Message == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+	input := update.Message.Text
+	if s.Stage == CommandReceived {
+		input = update.Message.CommandArguments()
+	}
+
+	if strings.TrimSpace(input) == "" {
+		s.Stage = SubscribeKeywordsReceived
+		writeState(s)
+		sendText(ctx, chatID, getLocalizedText(ctx, InputSubscriptionKeywords))
+		return
+	}
+
+	keywords := normalizeKeywords(input)
+	if len(keywords) == 0 || len(keywords) > maxSubscriptionKeywords {
+		s.Stage = SubscribeKeywordsReceived
+		writeState(s)
+		sendText(ctx, chatID, getLocalizedText(ctx, SubscriptionKeywordsInvalid))
+		return
+	}
+	clearState(s.ChatID)
+
+	if len(ddbGetSubscriptions(ctx, update.Message.From.ID)) >= maxSubscriptionsPerUser {
+		sendText(ctx, chatID, fmt.Sprintf(getLocalizedText(ctx, TooManySubscriptions), maxSubscriptionsPerUser))
+		return
+	}
+
+	ddbWriteSubscription(ctx, SubscriptionRecord{
+		UserID:    update.Message.From.ID,
+		Keywords:  strings.Join(keywords, " "),
+		CreatedAt: time.Now().Unix(),
+	})
+	mcache.Delete(subscriptionsKey)
+	sendText(ctx, chatID, fmt.Sprintf(getLocalizedText(ctx, Subscribed), strings.Join(keywords, " ")))
+}
+
+// unsubscribeCommandHandler handles /unsubscribe and /subscriptions, the subscriptions are listed with
+// buttons to remove them unless /unsubscribe is given the keywords
+func unsubscribeCommandHandler(ctx context.Context, update *tgbotapi.Update, s *CommandState) {
+	defer clearState(s.ChatID)
+
+	if update.Message == nil {
+		return
+	}
+	chatID := update.Message.Chat.ID
+	userID := update.Message.From.ID
+
+	if s.Command == "unsubscribe" {
+		if keywords := normalizeKeywords(update.Message.CommandArguments()); len(keywords) > 0 {
+			ddbDeleteSubscription(ctx, userID, strings.Join(keywords, " "))
+			mcache.Delete(subscriptionsKey)
+			sendText(ctx, chatID, getLocalizedText(ctx, Unsubscribed))
+			return
+		}
+	}
+
+	subs := ddbGetSubscriptions(ctx, userID)
+	if len(subs) == 0 {
+		sendText(ctx, chatID, getLocalizedText(ctx, NoSubscription))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, getLocalizedText(ctx, SubscriptionList)+"\n\n"+formatSubscriptions(subs))
+	msg.ReplyMarkup = subscriptionKeyboard(subs)
+	if _, err := botSend(ctx, msg); err != nil {
+		logger(ctx).Error().Err(err).Msg("send subscriptions")
+	}
+}
+
+// subscriptionKeyboard has a remove button for each subscription, referred to by its position
+// since the keywords may not fit in the callback data
+func subscriptionKeyboard(subs []SubscriptionRecord) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for i, sub := range subs {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ "+sub.Keywords, newCallbackData(CallbackSubscription, strconv.Itoa(i))),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// subscriptionCallbackHandler removes the subscription at the position
+func subscriptionCallbackHandler(ctx context.Context, update *tgbotapi.Update, args []string) {
+	defer answerCallback(ctx, update, "")
+
+	query := update.CallbackQuery
+	if len(args) < 1 || query.Message == nil {
+		return
+	}
+	i, err := strconv.Atoi(args[0])
+	if err != nil {
+		return
+	}
+
+	subs := ddbGetSubscriptions(ctx, query.From.ID)
+	if i < 0 || i >= len(subs) {
+		return
+	}
+	ddbDeleteSubscription(ctx, query.From.ID, subs[i].Keywords)
+	mcache.Delete(subscriptionsKey)
+	subs = append(subs[:i], subs[i+1:]...)
+
+	var edit tgbotapi.EditMessageTextConfig
+	if len(subs) == 0 {
+		edit = tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, getLocalizedText(ctx, NoSubscription))
+	} else {
+		content := getLocalizedText(ctx, SubscriptionList) + "\n\n" + formatSubscriptions(subs)
+		edit = tgbotapi.NewEditMessageTextAndMarkup(query.Message.Chat.ID, query.Message.MessageID, content, subscriptionKeyboard(subs))
+	}
+	if _, err := botSend(ctx, edit); err != nil {
+		logger(ctx).Error().Err(err).Msg("edit subscriptions")
+	}
+}
+
+func init() {
+	if v, err := strconv.Atoi(os.Getenv("SUBSCRIPTION_FLUSH_SECONDS")); err == nil && v > 0 {
+		alertFlushInterval = time.Duration(v) * time.Second
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestNormalizeKeywords(t *testing.T) {
+	if got := normalizeKeywords(" Golang  区块链 golang "); !reflect.DeepEqual(got, []string{"golang", "区块链"}) {
+		t.Errorf("normalizeKeywords = %v", got)
+	}
+	if got := normalizeKeywords("go <script>"); got != nil {
+		t.Errorf("invalid keyword accepted: %v", got)
+	}
+}
+
+func TestMatchKeywords(t *testing.T) {
+	g := GroupRecord{Title: "Golang 中文社区", Description: "讨论 Go 语言和区块链开发"}
+	if !matchKeywords([]string{"golang", "区块链"}, g) {
+		t.Error("expect matching all the keywords")
+	}
+	if matchKeywords([]string{"golang", "rust"}, g) {
+		t.Error("expect no match if any keyword is missing")
+	}
+	if matchKeywords(nil, g) {
+		t.Error("expect no match without keywords")
+	}
+}
+
+func TestAlertQueue(t *testing.T) {
+	q := newAlertQueue()
+	q.add(1, GroupRecord{ChatID: -100})
+	q.add(1, GroupRecord{ChatID: -100})
+	q.add(1, GroupRecord{ChatID: -101})
+	q.add(2, GroupRecord{ChatID: -100})
+
+	pending := q.take()
+	if len(pending[1]) != 2 || len(pending[2]) != 1 {
+		t.Fatalf("unexpected pending alerts: %v", pending)
+	}
+	if len(q.take()) != 0 {
+		t.Fatal("alerts should be cleared after take")
+	}
+}
+
+func TestAlertQueueFlushRequeuesUnsent(t *testing.T) {
+	newFakeDynamoDB(t)
+	var (
+		mu        sync.Mutex
+		failing   = true
+		delivered int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		rsp := tgbotapi.APIResponse{Ok: true, Result: json.RawMessage(`{"message_id":1,"date":0,"chat":{"id":7}}`)}
+		mu.Lock()
+		switch {
+		case r.PostForm.Get("text") != "" && failing:
+			rsp = tgbotapi.APIResponse{Ok: false, ErrorCode: http.StatusBadRequest, Description: "Bad Request"}
+		case r.PostForm.Get("text") != "":
+			delivered++
+		default:
+			rsp.Result = json.RawMessage(`{"id":1,"is_bot":true,"first_name":"bot","username":"bot"}`)
+		}
+		mu.Unlock()
+		json.NewEncoder(w).Encode(rsp)
+	}))
+	defer server.Close()
+	b, err := tgbotapi.NewBotAPIWithAPIEndpoint("test", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := bot
+	bot = b
+	defer func() { bot = saved }()
+
+	const userID = 7
+	key := alertRateKey + "7"
+	mcache.Delete(key)
+	defer mcache.Delete(key)
+	ctx := context.Background()
+
+	q := newAlertQueue()
+	q.add(userID, GroupRecord{ChatID: -100, Title: "a"})
+	q.flush(ctx)
+	if len(q.pending[userID]) != 1 || ddbNotified(ctx, userID, -100) {
+		t.Fatalf("failed alert should be queued again and not marked notified, pending %v", q.pending)
+	}
+	if _, found := mcache.Get(key); found {
+		t.Fatal("failed alert shouldn't count against the daily limit")
+	}
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	q.flush(ctx)
+	if delivered != 1 || len(q.pending) != 0 || !ddbNotified(ctx, userID, -100) {
+		t.Fatalf("expect the alert delivered and marked notified, delivered %d, pending %v", delivered, q.pending)
+	}
+	if n, _ := mcache.Get(key); n != 1 {
+		t.Fatalf("delivered alerts counted %v, want 1", n)
+	}
+
+	mcache.Set(key, alertDailyLimit, time.Hour)
+	q.add(userID, GroupRecord{ChatID: -101, Title: "b"})
+	q.flush(ctx)
+	if delivered != 1 || len(q.pending[userID]) != 1 || q.pending[userID][0].ChatID != -101 {
+		t.Fatalf("alert over the daily limit should be queued again, delivered %d, pending %v", delivered, q.pending)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegram's limits of the messages sent by a bot, refer to https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+const (
+	sendRatePerSecond    = 30
+	groupSendRatePerMin  = 20
+	groupSendBucketTTL   = 10 * time.Minute
+	formContentType      = "application/x-www-form-urlencoded"
+	sendMethodPrefix     = "send"
+	editMethodPrefix     = "edit"
+	copyMessageMethod    = "copyMessage"
+	forwardMessageMethod = "forwardMessage"
+	getUpdatesMethod     = "getUpdates"
+)
+
+// throttledClient delays the outgoing messages of the bot to stay within telegram's limits,
+// every bot API call goes through it so nothing has to be throttled by the callers
+type throttledClient struct {
+	client tgbotapi.HTTPClient
+	global *tokenBucket
+
+	mu        sync.Mutex
+	groups    map[int64]*tokenBucket
+	lastSweep time.Time
+}
+
+func newThrottledClient(client tgbotapi.HTTPClient) *throttledClient {
+	return &throttledClient{
+		client: client,
+		global: newTokenBucket(sendRatePerSecond, sendRatePerSecond),
+		groups: map[int64]*tokenBucket{},
+	}
+}
+
+// isSendMethod tells whether the bot API method sends or edits a message
+func isSendMethod(method string) bool {
+	return strings.HasPrefix(method, sendMethodPrefix) || strings.HasPrefix(method, editMethodPrefix) ||
+		method == copyMessageMethod || method == forwardMessageMethod
+}
+
+// getRequestChatID reads the target chat of a form encoded request and restores its body, 0 if unknown
+func getRequestChatID(req *http.Request) int64 {
+	if req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), formContentType) {
+		return 0
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 0
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return 0
+	}
+	chatID, _ := strconv.ParseInt(values.Get("chat_id"), 10, 64)
+	return chatID
+}
+
+func (c *throttledClient) groupBucket(chatID int64) *tokenBucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.groups[chatID]
+	if !ok {
+		b = newTokenBucket(groupSendRatePerMin, groupSendRatePerMin/60.0)
+		c.groups[chatID] = b
+	}
+	return b
+}
+
+// sweep drops the group buckets idle long enough to be full again, at most once per TTL
+func (c *throttledClient) sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) < groupSendBucketTTL {
+		return
+	}
+	c.lastSweep = now
+	for chatID, b := range c.groups {
+		b.mu.Lock()
+		idle := now.Sub(b.last) > groupSendBucketTTL
+		b.mu.Unlock()
+		if idle {
+			delete(c.groups, chatID)
+		}
+	}
+}
+
+func (c *throttledClient) Do(req *http.Request) (*http.Response, error) {
+	method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	if !isSendMethod(method) {
+		return c.do(method, req)
+	}
+
+	now := time.Now()
+	wait := c.global.reserve(now)
+	// negative chat IDs are groups and channels
+	if chatID := getRequestChatID(req); chatID < 0 {
+		if w := c.groupBucket(chatID).reserve(now); w > wait {
+			wait = w
+		}
+	}
+	c.sweep(now)
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return c.do(method, req)
+}
+
+// do makes the call limited to telegramTimeout after the throttling, except the long polling
+// which is bounded by its own timeout
+func (c *throttledClient) do(method string, req *http.Request) (*http.Response, error) {
+	var rsp *http.Response
+	var err error
+	if method == getUpdatesMethod {
+		rsp, err = c.client.Do(req)
+	} else {
+		rsp, err = withRequestTimeout(req, telegramTimeout, c.client.Do)
+	}
+	countTelegramError(method, rsp, err)
+	return rsp, err
+}
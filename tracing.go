@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the span exporters, chosen by TRACE_EXPORTER
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterFile   = "file" // appends to TRACE_FILE
+	TraceExporterOTLP   = "otlp" // posts to an OpenTelemetry collector by OTLP/HTTP
+)
+
+const (
+	otlpDefaultEndpoint = "localhost:4318"
+	tracerName          = "github.com/cifer76/tgbot-lambda"
+	traceServiceName    = "tgbot"
+	traceShutdownWait   = 5 * time.Second
+)
+
+// spans are dropped until the tracing is set up, or if it's disabled
+var tracer = otel.Tracer(tracerName)
+
+// startSpan starts a child span of the one in ctx, or a root span if there's none
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// failSpan marks the span failed by err
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// endSpan ends the span, marking it failed if err isn't nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		failSpan(span, err)
+	}
+	span.End()
+}
+
+// botSend sends the chattable in a span, for the callers expecting the sent message back
+func botSend(ctx context.Context, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	_, span := startSpan(ctx, "bot.Send")
+	m, err := bot.Send(c)
+	endSpan(span, err)
+	return m, err
+}
+
+// botRequest makes the bot API call in a span, for the calls that don't result in a message
+func botRequest(ctx context.Context, c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	_, span := startSpan(ctx, "bot.Request")
+	rsp, err := bot.Request(c)
+	endSpan(span, err)
+	return rsp, err
+}
+
+// exportedSpan is a finished span as written by jsonSpanExporter
+type exportedSpan struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Start      time.Time              `json:"start"`
+	DurationMs float64                `json:"duration_ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Status     string                 `json:"status,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+func newExportedSpan(s sdktrace.ReadOnlySpan) exportedSpan {
+	e := exportedSpan{
+		TraceID:    s.SpanContext().TraceID().String(),
+		SpanID:     s.SpanContext().SpanID().String(),
+		Name:       s.Name(),
+		Start:      s.StartTime(),
+		DurationMs: float64(s.EndTime().Sub(s.StartTime())) / float64(time.Millisecond),
+	}
+	if s.Parent().IsValid() {
+		e.ParentID = s.Parent().SpanID().String()
+	}
+	if attrs := s.Attributes(); len(attrs) > 0 {
+		e.Attributes = map[string]interface{}{}
+		for _, kv := range attrs {
+			e.Attributes[string(kv.Key)] = kv.Value.AsInterface()
+		}
+	}
+	if s.Status().Code == codes.Error {
+		e.Status, e.Error = s.Status().Code.String(), s.Status().Description
+	}
+	return e
+}
+
+// jsonSpanExporter writes the finished spans as JSON lines, for debugging offline without a collector
+type jsonSpanExporter struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer // nil for stdout
+}
+
+func newJSONSpanExporter(w io.Writer, closer io.Closer) *jsonSpanExporter {
+	return &jsonSpanExporter{enc: json.NewEncoder(w), closer: closer}
+}
+
+func (e *jsonSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range spans {
+		if err := e.enc.Encode(newExportedSpan(s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jsonSpanExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// newSpanExporter makes the exporter configured by TRACE_EXPORTER, nil if tracing is disabled
+func newSpanExporter() (sdktrace.SpanExporter, error) {
+	switch os.Getenv("TRACE_EXPORTER") {
+	case TraceExporterStdout:
+		return newJSONSpanExporter(os.Stdout, nil), nil
+	case TraceExporterFile:
+		path := os.Getenv("TRACE_FILE")
+		if path == "" {
+			path = "traces.jsonl"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return newJSONSpanExporter(f, f), nil
+	case TraceExporterOTLP:
+		// configured by the OTEL_EXPORTER_OTLP_* variables, e.g. the endpoint, headers and compression,
+		// the collector's OTLP/HTTP port on this host if no endpoint is set
+		opts := []otlptracehttp.Option{}
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(otlpDefaultEndpoint), otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, nil
+	}
+}
+
+// startTracing sets up the tracer provider with the configured exporter, the returned function
+// flushes the pending spans and is to be deferred
+func startTracing() func() {
+	exporter, err := newSpanExporter()
+	if err != nil {
+		baseLogger.Error().Err(err).Msg("create span exporter, tracing disabled")
+		return func() {}
+	}
+	if exporter == nil {
+		return func() {}
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", traceServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), traceShutdownWait)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			baseLogger.Error().Err(err).Msg("shutdown tracing")
+		}
+	}
+}
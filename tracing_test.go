@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestJSONSpanExporter(t *testing.T) {
+	var buf bytes.Buffer
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(newJSONSpanExporter(&buf, nil)))
+	tr := provider.Tracer("test")
+
+	ctx, root := tr.Start(context.Background(), "handleUpdate")
+	_, child := tr.Start(ctx, "opensearchWriteGroup", trace.WithAttributes(attribute.Int64("group_id", -100)))
+	endSpan(child, errors.New("boom"))
+	endSpan(root, nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d spans, want 2: %s", len(lines), buf.String())
+	}
+	spans := make([]exportedSpan, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &spans[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the child ends first
+	c, r := spans[0], spans[1]
+	if c.Name != "opensearchWriteGroup" || r.Name != "handleUpdate" {
+		t.Fatalf("unexpected spans: %s", buf.String())
+	}
+	if c.TraceID != r.TraceID || c.ParentID != r.SpanID || r.ParentID != "" {
+		t.Errorf("child isn't linked to the root: %s", buf.String())
+	}
+	if c.Attributes["group_id"] != float64(-100) {
+		t.Errorf("got attributes %v", c.Attributes)
+	}
+	if c.Status != "Error" || c.Error != "boom" || r.Status != "" {
+		t.Errorf("unexpected status: %s", buf.String())
+	}
+}
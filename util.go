@@ -25,10 +25,33 @@ func getChatIDFromUpdate(update *tgbotapi.Update) int64 {
 	return 0
 }
 
+func getUserFromUpdate(update *tgbotapi.Update) *tgbotapi.User {
+	if update.Message != nil {
+		return update.Message.From
+	} else if update.CallbackQuery != nil {
+		return update.CallbackQuery.From
+	}
+	return nil
+}
+
 func updateIsCommand(update *tgbotapi.Update) bool {
 	return update.Message != nil && update.Message.IsCommand()
 }
 
+func sendText(ctx context.Context, chatID int64, content string) {
+	msg := tgbotapi.NewMessage(chatID, content)
+	msg.DisableWebPagePreview = true
+	queueMessage(ctx, msg)
+}
+
+// getGroupURL links to the group by its username, or the invite link for a private group
+func getGroupURL(g GroupRecord) string {
+	if g.Username == "" && g.InviteLink != "" {
+		return g.InviteLink
+	}
+	return "https://t.me/" + g.Username
+}
+
 func formatMemberCount(count int) string {
 	memberCount := ""
 	if count < 1000 {
@@ -53,25 +76,47 @@ const (
 	UpdateType_UserUnblockedBot // user start or restart the bot
 	UpdateType_GroupAddedBot
 	UpdateType_GroupRemovedBot
+	UpdateType_GroupPromotedBot // the bot becomes an administrator of the group
+	UpdateType_GroupDemotedBot  // the bot loses the administrator rights of the group
+	UpdateType_ChannelAddedBot  // bots can only be added into channels as administrators
+	UpdateType_ChannelRemovedBot
+	UpdateType_ChannelPost
 )
 
 func determineUpdateType(ctx context.Context, update *tgbotapi.Update) int {
 	if update.MyChatMember != nil {
+		chat := update.MyChatMember.Chat
+		oldStatus := update.MyChatMember.OldChatMember.Status
 		status := update.MyChatMember.NewChatMember.Status
-		if update.MyChatMember.Chat.ID > 0 { // private chats
+		removed := status == "left" || status == "kicked"
+
+		if chat.IsPrivate() { // private chats
 			if status == "member" {
 				return UpdateType_UserUnblockedBot
 			} else if status == "kicked" {
 				return UpdateType_UserBlockedBot
 			}
-		} else { // supergroup chats
-			if status == "member" {
+		} else if chat.IsChannel() { // channels
+			if status == "administrator" {
+				return UpdateType_ChannelAddedBot
+			} else if removed || oldStatus == "administrator" {
+				// a demoted bot can't see the channel anymore
+				return UpdateType_ChannelRemovedBot
+			}
+		} else { // group and supergroup chats
+			if status == "administrator" && oldStatus == "member" {
+				return UpdateType_GroupPromotedBot
+			} else if status == "member" && oldStatus == "administrator" {
+				return UpdateType_GroupDemotedBot
+			} else if status == "member" || status == "administrator" {
 				return UpdateType_GroupAddedBot
-			} else if status == "left" {
+			} else if removed {
 				return UpdateType_GroupRemovedBot
 			}
 		}
 		return -1
+	} else if update.ChannelPost != nil {
+		return UpdateType_ChannelPost
 	} else if update.Message != nil {
 		if update.Message.Text != "" {
 			if updateIsCommand(update) {
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestDetermineUpdateType(t *testing.T) {
+	memberUpdate := func(chatType, oldStatus, newStatus string) tgbotapi.Update {
+		return tgbotapi.Update{
+			MyChatMember: &tgbotapi.ChatMemberUpdated{
+				Chat:          tgbotapi.Chat{ID: -100, Type: chatType},
+				OldChatMember: tgbotapi.ChatMember{Status: oldStatus},
+				NewChatMember: tgbotapi.ChatMember{Status: newStatus},
+			},
+		}
+	}
+
+	cases := []struct {
+		name   string
+		update tgbotapi.Update
+		want   int
+	}{
+		{"user started", memberUpdate("private", "kicked", "member"), UpdateType_UserUnblockedBot},
+		{"user blocked", memberUpdate("private", "member", "kicked"), UpdateType_UserBlockedBot},
+		{"group added", memberUpdate("supergroup", "left", "member"), UpdateType_GroupAddedBot},
+		{"group added as admin", memberUpdate("group", "left", "administrator"), UpdateType_GroupAddedBot},
+		{"group promoted", memberUpdate("supergroup", "member", "administrator"), UpdateType_GroupPromotedBot},
+		{"group demoted", memberUpdate("supergroup", "administrator", "member"), UpdateType_GroupDemotedBot},
+		{"group removed", memberUpdate("supergroup", "member", "kicked"), UpdateType_GroupRemovedBot},
+		{"channel added", memberUpdate("channel", "left", "administrator"), UpdateType_ChannelAddedBot},
+		{"channel removed", memberUpdate("channel", "administrator", "left"), UpdateType_ChannelRemovedBot},
+		{"channel post", tgbotapi.Update{ChannelPost: &tgbotapi.Message{Text: "hi"}}, UpdateType_ChannelPost},
+	}
+	for _, c := range cases {
+		if got := determineUpdateType(context.Background(), &c.update); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// when set, a group submitted by /add is only indexed if the requester owns it
+var requireGroupOwnership bool
+
+// verifyGroupOwnership checks whether the user is the creator or an administrator of the group
+func verifyGroupOwnership(ctx context.Context, chatID, userID int64) string {
+	member, err := bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatID: chatID,
+			UserID: userID,
+		},
+	})
+	if err == nil {
+		if member.IsCreator() || member.IsAdministrator() {
+			return VerificationVerified
+		}
+		return VerificationUnverified
+	}
+	logger(ctx).Error().Err(err).Int64("user_id", userID).Int64("group_id", chatID).Msg("getChatMember")
+
+	// getChatMember may be refused if the bot isn't in the group, try the administrator list
+	admins, err := bot.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+	})
+	if err != nil {
+		logger(ctx).Error().Err(err).Int64("group_id", chatID).Msg("getChatAdministrators")
+		return VerificationUnverified
+	}
+	for _, a := range admins {
+		if a.User != nil && a.User.ID == userID {
+			return VerificationVerified
+		}
+	}
+	return VerificationUnverified
+}
+
+func init() {
+	requireGroupOwnership = os.Getenv("REQUIRE_GROUP_OWNERSHIP") == "true"
+}